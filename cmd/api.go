@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/api"
+	"digitalocean-registry-cleaner/pkg/cleanup"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	apiConfig string
+	apiTokens string
+	apiAddr   string
+)
+
+var apiCmd = &cobra.Command{
+	Use:   "api",
+	Short: "Serve the HTTP API",
+	Long:  `Command serves an HTTP API to list tags, preview and run the cleanup of a repository with the policy of the [config] file. Cleanups take the run lock and record deletions in the audit log, quarantine state and notifications of the config file like dorc run. Bearer tokens of the [tokens-file] are scoped to repositories.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := loadRunOptions(apiConfig, cmd.Flags(), runOpts)
+		if err != nil {
+			return err
+		}
+
+		opts, err := singleRegistry(list)
+		if err != nil {
+			return err
+		}
+
+		policy, err := cleanupPolicy(opts)
+		if err != nil {
+			return err
+		}
+
+		tokens, err := readAPITokens(apiTokens)
+		if err != nil {
+			return err
+		}
+
+		notifiers, err := newNotifiers(opts)
+		if err != nil {
+			return err
+		}
+
+		doc, err := registryClient(opts)
+		if err != nil {
+			return err
+		}
+
+		if err := doc.ValidateToken(); err != nil {
+			return err
+		}
+
+		server := api.NewServer(doc, policy, tokens)
+		server.SetGuard(func(repository string) cleanup.Guard {
+			return guardFor(opts, repository)
+		})
+		server.SetRunConfig(runConfig(opts, notifiers, nil))
+
+		slog.Info("serving api", "addr", apiAddr)
+		srv := &http.Server{Addr: apiAddr, Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second}
+		return srv.ListenAndServe()
+	},
+}
+
+func init() {
+	apiCmd.Flags().StringVar(&apiConfig, "config", "", "YAML config file with the cleanup policy")
+	apiCmd.Flags().StringVar(&apiTokens, "tokens-file", "", "YAML file with the bearer tokens and their repositories")
+	apiCmd.Flags().StringVar(&apiAddr, "addr", ":8081", "Address the API listens on")
+	apiCmd.Flags().StringVar(&runOpts.Registry, "registry", "", "Registry served by the API if the config file lists several registries")
+
+	_ = apiCmd.MarkFlagRequired("config")
+	_ = apiCmd.MarkFlagRequired("tokens-file")
+}
+
+// readAPITokens reads the bearer tokens of the API.
+func readAPITokens(path string) ([]api.Token, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read tokens-file: %w", err)
+	}
+
+	var file struct {
+		Tokens []api.Token `yaml:"tokens"`
+	}
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("could not parse tokens-file: %w", err)
+	}
+
+	for _, token := range file.Tokens {
+		if token.Token == "" {
+			return nil, fmt.Errorf("token %q in tokens-file is empty", token.Name)
+		}
+		if len(token.Repositories) == 0 {
+			return nil, fmt.Errorf("token %q in tokens-file has no repositories", token.Name)
+		}
+	}
+
+	if len(file.Tokens) == 0 {
+		return nil, fmt.Errorf("tokens-file has no tokens")
+	}
+
+	return file.Tokens, nil
+}
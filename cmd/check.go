@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+
+	"digitalocean-registry-cleaner/pkg/do"
+
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the token, registry and repositories",
+	Long:  `Command checks that the token is valid and may delete tags and that the registry and repositories of the run options exist. Nothing is deleted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := loadRunOptions(configFile, cmd.Flags(), runOpts)
+		if err != nil {
+			return err
+		}
+
+		var failed int
+		for _, opts := range list {
+			problems, err := preflight(opts)
+			if err != nil {
+				problems = []do.Problem{{Subject: "token", Message: err.Error(), Hint: "check the token source"}}
+			}
+
+			fmt.Printf("Registry: %s\n", opts.Registry)
+			if len(problems) == 0 {
+				fmt.Printf("OK: token is valid, registry and %d repositories exist\n", len(opts.Repositories))
+			}
+			for _, problem := range problems {
+				fmt.Printf("Problem: %s: %s\n  Hint: %s\n", problem.Subject, problem.Message, problem.Hint)
+			}
+			fmt.Println("=====")
+
+			failed += len(problems)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("check failed with %d problems", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	addRunFlags(checkCmd.Flags())
+}
+
+// preflight checks the token, registry and repositories and the pins of the options.
+// The delete scope of the token is verified unless the options are a dry run.
+func preflight(opts *runOptions) ([]do.Problem, error) {
+	doc, err := opts.Token.client(opts.Protected)
+	if err != nil {
+		return nil, err
+	}
+	problems := doc.Preflight(opts.Registry, opts.Repositories, !opts.DryRun)
+
+	if opts.Pins != "" {
+		store, err := openPins(opts)
+		if err == nil {
+			_, err = store.Load()
+		}
+		if err != nil {
+			problems = append(problems, do.Problem{Subject: "pins " + opts.Pins, Message: err.Error(), Hint: "check the pins target and the permissions to read it"})
+		}
+	}
+
+	return problems, nil
+}
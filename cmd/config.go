@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// loadRunOptions returns the options of every registry of the config file (if any) on top of the defaults,
+// flags changed on the command line take precedence over the config file.
+// When the config file lists registries, the registry flag selects one of them.
+func loadRunOptions(path string, flags *pflag.FlagSet, defaults runOptions) ([]*runOptions, error) {
+	opts := defaults
+	if !flags.Changed("open-pr") {
+		opts.OpenPRs = nil // open pull requests are unknown unless configured
+	}
+
+	if path == "" {
+		return []*runOptions{&opts}, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+
+	if err := decodeStrict(content, &opts); err != nil {
+		return nil, fmt.Errorf("could not parse config %s: %w", path, err)
+	}
+
+	if len(opts.Registries) == 0 {
+		applyFlags(&opts, flags, defaults, "")
+		return []*runOptions{&opts}, nil
+	}
+
+	var list []*runOptions
+	for i, node := range opts.Registries {
+		// every registry inherits the top-level options
+		entry := opts
+		entry.Registries = nil
+		entry.Guards = maps.Clone(opts.Guards)
+		if hasKey(&node, "token") {
+			// a token source of the registry replaces the top-level one instead of being merged into it
+			entry.Token = tokenSource{}
+		}
+
+		content, err := yaml.Marshal(&node)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse config %s: %w", path, err)
+		}
+		if err := decodeStrict(content, &entry); err != nil {
+			return nil, fmt.Errorf("could not parse registry #%d of config %s: %w", i+1, path, err)
+		}
+		if len(entry.Registries) > 0 {
+			return nil, fmt.Errorf("registry #%d of config %s must not list registries", i+1, path)
+		}
+
+		if flags.Changed("registry") && entry.Registry != defaults.Registry {
+			continue
+		}
+
+		applyFlags(&entry, flags, defaults, "registry")
+		list = append(list, &entry)
+	}
+
+	if len(list) == 0 {
+		return nil, fmt.Errorf("registry %s is not in config %s", defaults.Registry, path)
+	}
+
+	return list, nil
+}
+
+// hasKey reports whether the YAML mapping node has the key.
+func hasKey(node *yaml.Node, key string) bool {
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeStrict decodes the YAML content, unknown keys are errors.
+func decodeStrict(content []byte, opts *runOptions) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(opts); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// applyFlags sets the options of flags changed on the command line, except for the skipped flag.
+func applyFlags(opts *runOptions, flags *pflag.FlagSet, defaults runOptions, skip string) {
+	value := reflect.ValueOf(opts).Elem()
+	defaultValue := reflect.ValueOf(defaults)
+	for i := range value.NumField() {
+		name := value.Type().Field(i).Tag.Get("flag")
+		if name != "" && name != skip && flags.Changed(name) {
+			value.Field(i).Set(defaultValue.Field(i))
+		}
+	}
+}
+
+// addRegistryFlags registers the flags selecting a registry of the config file, e.g. for its token.
+func addRegistryFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&configFile, "config", "", "YAML config file with the options, flags take precedence")
+	flags.StringVar(&runOpts.Registry, "registry", "", "Registry name")
+}
+
+// registryOptions returns the options of the registry from the list,
+// or the only options of the list if they name no registry.
+func registryOptions(list []*runOptions, registry string) (*runOptions, error) {
+	for _, opts := range list {
+		if opts.Registry == registry {
+			return opts, nil
+		}
+	}
+	if len(list) == 1 && list[0].Registry == "" {
+		return list[0], nil
+	}
+	return nil, fmt.Errorf("registry %s is not in config %s", registry, configFile)
+}
+
+// singleRegistry returns the options of the only registry of the list.
+func singleRegistry(list []*runOptions) (*runOptions, error) {
+	if len(list) > 1 {
+		return nil, fmt.Errorf("config lists %d registries, select one with --registry", len(list))
+	}
+	return list[0], nil
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRunOptions loads the config with the run flags parsed from the arguments.
+func testRunOptions(t *testing.T, config string, args ...string) ([]*runOptions, error) {
+	path := filepath.Join(t.TempDir(), "dorc.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(config), 0o644))
+
+	flags := pflag.NewFlagSet("run", pflag.ContinueOnError)
+	addRunFlags(flags)
+	assert.NoError(t, flags.Parse(args))
+
+	return loadRunOptions(path, flags, runOpts)
+}
+
+func TestLoadRunOptions_RegistryToken(t *testing.T) {
+	list, err := testRunOptions(t, `
+token:
+  file: /secrets/a
+registries:
+  - registry: team-a
+  - registry: team-b
+    token:
+      env: TEAM_B
+`)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, tokenSource{File: "/secrets/a"}, list[0].Token)
+	assert.Equal(t, tokenSource{Env: "TEAM_B"}, list[1].Token)
+}
+
+func TestLoadRunOptions_InheritsTopLevel(t *testing.T) {
+	list, err := testRunOptions(t, `
+keepTags: 3
+guards:
+  backend:
+    maxDelete: 2
+registries:
+  - registry: team-a
+  - registry: team-b
+    keepTags: 7
+    guards:
+      frontend:
+        maxDelete: 4
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, list[0].KeepTags)
+	assert.Equal(t, 7, list[1].KeepTags)
+	assert.NotContains(t, list[0].Guards, "frontend")
+	assert.Contains(t, list[1].Guards, "backend")
+}
+
+func TestLoadRunOptions_FlagsTakePrecedence(t *testing.T) {
+	list, err := testRunOptions(t, `
+keepTags: 3
+minAgeDays: 10
+registries:
+  - registry: team-a
+  - registry: team-b
+`, "--keep-tags=9", "--registry=team-b")
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "team-b", list[0].Registry)
+	assert.Equal(t, 9, list[0].KeepTags)
+	assert.Equal(t, 10, list[0].MinAgeDays)
+}
+
+func TestLoadRunOptions_UnknownKey(t *testing.T) {
+	_, err := testRunOptions(t, "keepTag: 3\n")
+	assert.ErrorContains(t, err, "field keepTag not found")
+
+	_, err = testRunOptions(t, "registries:\n  - registry: team-a\n    token:\n      envv: X\n")
+	assert.ErrorContains(t, err, "registry #1")
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+
+	"github.com/spf13/cobra"
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <repository>:<tag>",
+	Short: "Explain the decision about a tag",
+	Long:  `Command prints why the retention policy of the run options keeps or deletes the tag, nothing is deleted.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repository, tag, err := parseTagRef(args[0])
+		if err != nil {
+			return err
+		}
+
+		list, err := loadRunOptions(configFile, cmd.Flags(), runOpts)
+		if err != nil {
+			return err
+		}
+
+		opts, err := singleRegistry(list)
+		if err != nil {
+			return err
+		}
+
+		policy, err := cleanupPolicy(opts)
+		if err != nil {
+			return err
+		}
+
+		doc, err := registryClient(opts)
+		if err != nil {
+			return err
+		}
+
+		// the storage target selects tags across all repositories of the run
+		repositories := []string{repository}
+		if opts.TargetUsage != "" {
+			repositories = append(repositories, slices.DeleteFunc(slices.Clone(opts.Repositories), func(r string) bool { return r == repository })...)
+		}
+
+		var plans []*cleanup.Decisions
+		for _, r := range repositories {
+			input := policy
+			input.Repository = r
+			plan, err := doc.PlanCleanup(input)
+			if err != nil {
+				return fmt.Errorf("could not plan cleanup of %s: %w", r, err)
+			}
+			plans = append(plans, plan)
+		}
+
+		if opts.TargetUsage != "" {
+			target, err := cleanup.ParseUsageTarget(opts.TargetUsage)
+			if err != nil {
+				return err
+			}
+			if err := selectForTarget(doc, opts.Registry, plans, target); err != nil {
+				return err
+			}
+		}
+
+		plan := plans[0]
+		decision, ok := plan.Explain(tag)
+		if !ok {
+			return fmt.Errorf("tag %s not found in repository %s", tag, repository)
+		}
+
+		var updatedAt time.Time
+		for _, t := range plan.Tags {
+			if t.Tag == tag {
+				updatedAt = t.UpdatedAt
+			}
+		}
+
+		action := "keep"
+		if decision.Delete {
+			action = "delete"
+		}
+
+		fmt.Printf("Registry: %s\n", plan.Registry)
+		fmt.Printf("Repository: %s\n", plan.Repository)
+		fmt.Printf("Tag: %s\n", decision.Tag)
+		fmt.Printf("Updated: %s\n", updatedAt.Format(time.RFC3339))
+		fmt.Printf("Kind: %s\n", decision.Kind)
+		fmt.Printf("Decision: %s\n", action)
+		fmt.Printf("Explanation: %s\n", decision.Explanation)
+
+		return nil
+	},
+}
+
+func init() {
+	addRunFlags(explainCmd.Flags())
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var forecastDays int
+
+// forecastEntry is a tag deleted within the forecast window.
+type forecastEntry struct {
+	Registry   string    `json:"registry"`
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	DeleteAt   time.Time `json:"delete_at"`
+	DaysLeft   int       `json:"days_left"`
+	Reason     string    `json:"reason"`
+}
+
+var forecastCmd = &cobra.Command{
+	Use:   "forecast",
+	Short: "List tags deleted in the coming days",
+	Long: `Command lists the tags kept today which the retention policy of the run options deletes within [days],
+with the date each tag crosses the age threshold. Nothing is deleted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("output must be text or json")
+		}
+
+		if forecastDays < 1 {
+			return fmt.Errorf("days must be greater than 0")
+		}
+
+		list, err := loadRunOptions(configFile, cmd.Flags(), runOpts)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		entries := []forecastEntry{}
+		var errs []error
+		for _, opts := range list {
+			forecast, err := forecastRegistry(opts, now)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("registry %s: %w", opts.Registry, err))
+			}
+			entries = append(entries, forecast...)
+		}
+
+		if outputFormat == "json" {
+			if err := printJSON(entries); err != nil {
+				return err
+			}
+		} else {
+			printForecast(entries, now)
+		}
+
+		return errors.Join(errs...)
+	},
+}
+
+func init() {
+	addRunFlags(forecastCmd.Flags())
+	forecastCmd.Flags().IntVar(&forecastDays, "days", 14, "Forecast window in days")
+	forecastCmd.Flags().StringVar(&outputFormat, "output", "text", "Output format: text or json")
+}
+
+// forecastRegistry lists the tags of every repository of the registry deleted within the window.
+func forecastRegistry(opts *runOptions, now time.Time) ([]forecastEntry, error) {
+	if len(opts.Repositories) == 0 {
+		return nil, fmt.Errorf("at least one repository is required")
+	}
+
+	policy, err := cleanupPolicy(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := registryClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	doc.SetClock(func() time.Time { return now })
+
+	var entries []forecastEntry
+	for _, repository := range opts.Repositories {
+		input := policy
+		input.Repository = repository
+
+		upcoming, err := doc.ForecastCleanup(input, time.Duration(forecastDays)*24*time.Hour)
+		if err != nil {
+			return entries, fmt.Errorf("could not forecast cleanup of %s: %w", repository, err)
+		}
+
+		for _, u := range upcoming {
+			entries = append(entries, forecastEntry{
+				Registry:   opts.Registry,
+				Repository: repository,
+				Tag:        u.Tag.Tag,
+				UpdatedAt:  u.Tag.UpdatedAt,
+				DeleteAt:   u.At,
+				DaysLeft:   daysUntil(now, u.At),
+				Reason:     string(u.Reason),
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// daysUntil rounds the time until at up to whole days.
+func daysUntil(now, at time.Time) int {
+	return int((at.Sub(now) + 24*time.Hour - 1) / (24 * time.Hour))
+}
+
+func printForecast(entries []forecastEntry, now time.Time) {
+	fmt.Printf("==> Forecast for %d days from %s\n\n", forecastDays, now.Format(time.RFC3339))
+
+	var registry, repository string
+	for _, entry := range entries {
+		if entry.Registry != registry || entry.Repository != repository {
+			if repository != "" {
+				fmt.Println("=====")
+			}
+			registry, repository = entry.Registry, entry.Repository
+			fmt.Printf("Registry: %s\n", registry)
+			fmt.Printf("Repository: %s\n\n", repository)
+		}
+		fmt.Printf("Delete tag: %s\t%s\tin %d days\t%s\n", entry.Tag, entry.DeleteAt.Format(time.DateOnly), entry.DaysLeft, entry.Reason)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No tags are deleted in the window")
+		return
+	}
+	fmt.Println("=====")
+	fmt.Printf("%d tags are deleted in the next %d days\n", len(entries), forecastDays)
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"fmt"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+)
+
+// formatUsage formats a size along with its share of the limit, e.g. 4.0 GiB (80.0%).
+func formatUsage(size, limit int64) string {
+	if limit <= 0 {
+		return cleanup.FormatBytes(size)
+	}
+	return fmt.Sprintf("%s (%.1f%%)", cleanup.FormatBytes(size), float64(size)*100/float64(limit))
+}
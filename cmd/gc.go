@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/quarantine"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcState     string
+	gcType      string
+	gracePeriod time.Duration
+	gcForce     bool
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Start garbage collection",
+	Long:  `Command starts garbage collection of the registry unless tags were quarantined within the [grace-period].`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := loadRunOptions(configFile, cmd.Flags(), runOpts)
+		if err != nil {
+			return err
+		}
+
+		opts, err := singleRegistry(list)
+		if err != nil {
+			return err
+		}
+		if opts.Registry == "" {
+			return fmt.Errorf("registry is required")
+		}
+
+		var state *quarantine.State
+		if gcState != "" {
+			state, err = quarantine.Load(gcState)
+			if err != nil {
+				return err
+			}
+
+			var pending []quarantine.Entry
+			for _, entry := range state.Pending(time.Now().Add(-gracePeriod)) {
+				if entry.Registry == opts.Registry {
+					pending = append(pending, entry)
+				}
+			}
+
+			if len(pending) > 0 && !gcForce {
+				for _, entry := range pending {
+					fmt.Printf("Quarantined tag: %s/%s:%s\t%s\trun %s\n", entry.Registry, entry.Repository, entry.Tag, entry.DeletedAt.Format(time.RFC3339), entry.RunID)
+				}
+				return fmt.Errorf("%d tags were quarantined within the grace period of %s, use --force to collect them anyway", len(pending), gracePeriod)
+			}
+		}
+
+		doc, err := opts.Token.client(nil)
+		if err != nil {
+			return err
+		}
+
+		startedAt := time.Now()
+		gc, err := doc.StartGarbageCollection(opts.Registry, gcType)
+		if err != nil {
+			return fmt.Errorf("could not start garbage collection: %w", err)
+		}
+
+		fmt.Printf("Garbage collection: %s\t%s\n", gc.UUID, gc.Status)
+
+		if state != nil {
+			// quarantined manifests are gone once garbage collection runs
+			state.Prune(opts.Registry, startedAt)
+			if err := state.Save(gcState); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addRegistryFlags(gcCmd.Flags())
+	gcCmd.Flags().StringVar(&gcType, "type", "", `Garbage collection type: "untagged manifests only", "unreferenced blobs only" or "untagged manifests and unreferenced blobs"`)
+	gcCmd.Flags().StringVar(&gcState, "quarantine-state", "", "State file with the quarantined tags")
+	gcCmd.Flags().DurationVar(&gracePeriod, "grace-period", 72*time.Hour, "How long quarantined tags can be restored before garbage collection is allowed")
+	gcCmd.Flags().BoolVar(&gcForce, "force", false, "Start garbage collection even within the grace period")
+}
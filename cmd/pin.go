@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/pin"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	pinUntil  string
+	pinReason string
+)
+
+var pinCmd = &cobra.Command{
+	Use:   "pin <repository>:<tag>",
+	Short: "Keep a tag until a date",
+	Long: `Command pins the tag until [until] so that no run deletes it whatever the retention policy decides,
+e.g. while an incident is investigated. Pinning a pinned tag replaces its pin.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repository, tag, err := parseTagRef(args[0])
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		until, err := parseAsOf(pinUntil, now)
+		if err != nil {
+			return fmt.Errorf("invalid until: %w", err)
+		}
+		if !until.After(now) {
+			return fmt.Errorf("until must be in the future")
+		}
+
+		opts, store, err := loadPins(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		p := pin.Pin{
+			Registry:   opts.Registry,
+			Repository: repository,
+			Tag:        tag,
+			Until:      until.UTC(),
+			Reason:     pinReason,
+			CreatedBy:  pinCreator(),
+			CreatedAt:  now.UTC(),
+		}
+		err = store.Update(func(pins []pin.Pin) ([]pin.Pin, error) {
+			return pin.Add(pins, p, now), nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not pin %s: %w", args[0], err)
+		}
+
+		fmt.Printf("Pinned %s:%s until %s\n", repository, tag, p.Until.Format(time.RFC3339))
+		return nil
+	},
+}
+
+var unpinCmd = &cobra.Command{
+	Use:   "unpin <repository>:<tag>",
+	Short: "Remove the pin of a tag",
+	Long:  `Command removes the pin of the tag, the retention policy decides about it again.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repository, tag, err := parseTagRef(args[0])
+		if err != nil {
+			return err
+		}
+
+		opts, store, err := loadPins(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		err = store.Update(func(pins []pin.Pin) ([]pin.Pin, error) {
+			pins, found := pin.Remove(pins, opts.Registry, repository, tag, time.Now())
+			if !found {
+				return nil, fmt.Errorf("tag %s is not pinned", args[0])
+			}
+			return pins, nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not unpin %s: %w", args[0], err)
+		}
+
+		fmt.Printf("Unpinned %s:%s\n", repository, tag)
+		return nil
+	},
+}
+
+var pinsCmd = &cobra.Command{
+	Use:   "pins",
+	Short: "List pinned tags",
+	Long:  `Command lists the pinned tags of the registry, pins expired since the last change of the pins are marked as expired.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if outputFormat != "text" && outputFormat != "json" {
+			return fmt.Errorf("output must be text or json")
+		}
+
+		opts, store, err := loadPins(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		pins, err := store.Load()
+		if err != nil {
+			return err
+		}
+		pins = slices.DeleteFunc(pins, func(p pin.Pin) bool {
+			return p.Registry != opts.Registry
+		})
+		slices.SortFunc(pins, func(a, b pin.Pin) int {
+			return a.Until.Compare(b.Until)
+		})
+
+		if outputFormat == "json" {
+			if pins == nil {
+				pins = []pin.Pin{}
+			}
+			return printJSON(pins)
+		}
+
+		now := time.Now()
+		for _, p := range pins {
+			status := "active"
+			if p.Expired(now) {
+				status = "expired"
+			}
+			fmt.Printf("Pin: %s:%s\t%s\t%s\t%s\t%s\n", p.Repository, p.Tag, p.Until.Format(time.RFC3339), status, p.CreatedBy, p.Reason)
+		}
+		fmt.Printf("%d pinned tags in registry %s\n", len(pins), opts.Registry)
+
+		return nil
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{pinCmd, unpinCmd, pinsCmd} {
+		addPinFlags(cmd.Flags())
+	}
+	pinCmd.Flags().StringVar(&pinUntil, "until", "", "Keep the tag until the date (2026-12-01, midnight UTC) or time (RFC 3339)")
+	pinCmd.Flags().StringVar(&pinReason, "reason", "", "Why the tag is pinned, e.g. an incident")
+	pinsCmd.Flags().StringVar(&outputFormat, "output", "text", "Output format: text or json")
+
+	_ = pinCmd.MarkFlagRequired("until")
+}
+
+// addPinFlags registers the flags selecting the registry and its pins.
+func addPinFlags(flags *pflag.FlagSet) {
+	addRegistryFlags(flags)
+	addPinsFlag(flags)
+	addS3Flags(flags)
+}
+
+// addPinsFlag registers the flag of the pins store.
+func addPinsFlag(flags *pflag.FlagSet) {
+	flags.StringVar(&runOpts.Pins, "pins", "", "Pins keeping tags until a date: a local file, a Kubernetes ConfigMap (configmap://namespace/name) or an S3-compatible object (s3://bucket/key)")
+}
+
+// loadPins returns the options of the registry and its pins.
+func loadPins(flags *pflag.FlagSet) (*runOptions, pin.Store, error) {
+	list, err := loadRunOptions(configFile, flags, runOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts, err := singleRegistry(list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.Registry == "" {
+		return nil, nil, fmt.Errorf("registry is required")
+	}
+	if opts.Pins == "" {
+		return nil, nil, fmt.Errorf("pins is required")
+	}
+
+	store, err := openPins(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return opts, store, nil
+}
+
+// openPins opens the pins of the options.
+func openPins(opts *runOptions) (pin.Store, error) {
+	return pin.Open(opts.Pins, pin.Config{S3: s3Config(opts)})
+}
+
+// pinSource returns the pins of a repository from the store, loaded again for every plan.
+func pinSource(store pin.Store) func(registry, repository string) ([]cleanup.Pin, error) {
+	return func(registry, repository string) ([]cleanup.Pin, error) {
+		pins, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		return pin.ForRepository(pins, registry, repository), nil
+	}
+}
+
+// parseTagRef splits <repository>:<tag>.
+func parseTagRef(ref string) (string, string, error) {
+	i := strings.LastIndex(ref, ":")
+	if i < 1 || i == len(ref)-1 {
+		return "", "", fmt.Errorf("expected <repository>:<tag>, got %q", ref)
+	}
+	return ref[:i], ref[i+1:], nil
+}
+
+// pinCreator identifies who pins a tag, the user and the host.
+func pinCreator() string {
+	hostname, _ := os.Hostname()
+	if user := os.Getenv("USER"); user != "" {
+		return user + "@" + hostname
+	}
+	return hostname
+}
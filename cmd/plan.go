@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+
+	"github.com/spf13/cobra"
+)
+
+var planAsOf string
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show which tags a run would delete",
+	Long: `Command plans the cleanup of the run options without deleting anything.
+With --as-of the plan is made at a future date to see upcoming deletions in advance.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asOf, err := parseAsOf(planAsOf, time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid as-of: %w", err)
+		}
+
+		list, err := loadRunOptions(configFile, cmd.Flags(), runOpts)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("==> Plan as of %s\n\n", asOf.Format(time.RFC3339))
+
+		var errs []error
+		for _, opts := range list {
+			if err := printPlan(opts, asOf); err != nil {
+				errs = append(errs, fmt.Errorf("registry %s: %w", opts.Registry, err))
+			}
+		}
+
+		return errors.Join(errs...)
+	},
+}
+
+func init() {
+	addRunFlags(planCmd.Flags())
+	planCmd.Flags().StringVar(&planAsOf, "as-of", "", "Plan as of the date (2026-11-01, midnight UTC) or time (RFC 3339) instead of now")
+}
+
+// parseAsOf parses a date or an RFC 3339 time, empty is now.
+func parseAsOf(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date (2026-11-01) or an RFC 3339 time, got %q", value)
+	}
+
+	return t, nil
+}
+
+// printPlan prints the tags of every repository of the registry deleted at the time.
+func printPlan(opts *runOptions, asOf time.Time) error {
+	if len(opts.Repositories) == 0 {
+		return fmt.Errorf("at least one repository is required")
+	}
+
+	policy, err := cleanupPolicy(opts)
+	if err != nil {
+		return err
+	}
+
+	doc, err := registryClient(opts)
+	if err != nil {
+		return err
+	}
+	doc.SetClock(func() time.Time { return asOf })
+
+	if opts.TargetUsage != "" {
+		fmt.Print("Note: the storage target is not simulated, only the retention policy\n\n")
+	}
+
+	for _, repository := range opts.Repositories {
+		input := policy
+		input.Repository = repository
+		input.Guard = guardFor(opts, repository)
+
+		plan, err := doc.PlanCleanup(input)
+		if err != nil {
+			return fmt.Errorf("could not plan cleanup of %s: %w", repository, err)
+		}
+
+		if opts.Explain {
+			printDecisions(plan)
+			continue
+		}
+
+		fmt.Printf("Registry: %s\n", plan.Registry)
+		fmt.Printf("Repository: %s\n\n", plan.Repository)
+		for _, tag := range plan.Delete {
+			fmt.Printf("Delete tag: %s\t%s\t%s\n", tag.Tag, tag.UpdatedAt.Format(time.RFC3339), plan.Reasons[tag.Tag])
+		}
+		fmt.Printf("Delete %d of %d tags, frees %s\n", len(plan.Delete), len(plan.Tags), cleanup.FormatBytes(plan.EstimateFreedBytes()))
+		if err := plan.Check(); err != nil {
+			fmt.Printf("Warning: %s\n", err)
+		}
+		fmt.Println("=====")
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/do"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	outputFormat string
+	warnAbove    float64
+)
+
+// registryReport describes the registry, its subscription and storage usage.
+type registryReport struct {
+	Name                  string                `json:"name"`
+	Region                string                `json:"region"`
+	CreatedAt             time.Time             `json:"created_at"`
+	Tier                  string                `json:"tier"`
+	StorageUsageBytes     int64                 `json:"storage_usage_bytes"`
+	StorageLimitBytes     int64                 `json:"storage_limit_bytes"`
+	StorageUsagePercent   float64               `json:"storage_usage_percent"`
+	StorageUsageUpdatedAt time.Time             `json:"storage_usage_updated_at"`
+	AllowStorageOverage   bool                  `json:"allow_storage_overage"`
+	Repositories          int                   `json:"repositories"`
+	RepositoryLimit       int                   `json:"repository_limit"`
+	LastGarbageCollection *do.GarbageCollection `json:"last_garbage_collection"`
+}
+
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Inspect the registry",
+	Long:  `Commands showing the registry, its subscription tier and storage usage.`,
+}
+
+var registryInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show registry details",
+	Long:  `Command shows the registry name, region, subscription tier, storage usage, repository count and last garbage collection.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report, err := loadRegistryReport(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		if outputFormat == "json" {
+			return printJSON(report)
+		}
+
+		fmt.Printf("Registry: %s\n", report.Name)
+		fmt.Printf("Region: %s\n", report.Region)
+		fmt.Printf("Created: %s\n", report.CreatedAt.Format(time.RFC3339))
+		fmt.Printf("Tier: %s\n", report.Tier)
+		printRegistryUsage(report)
+		return nil
+	},
+}
+
+var registryUsageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show registry storage usage",
+	Long:  `Command shows storage used vs. the subscription tier limit and fails when usage is above [warn-above] percent.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if warnAbove < 0 || warnAbove > 100 {
+			return fmt.Errorf("warn-above must be between 0 and 100")
+		}
+
+		report, err := loadRegistryReport(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		if outputFormat == "json" {
+			if err := printJSON(report); err != nil {
+				return err
+			}
+		} else {
+			printRegistryUsage(report)
+		}
+
+		if warnAbove > 0 && report.StorageUsagePercent > warnAbove {
+			return fmt.Errorf("storage usage %.1f%% is above %.1f%%", report.StorageUsagePercent, warnAbove)
+		}
+
+		return nil
+	},
+}
+
+// loadRegistryReport reports the registry of the token of the selected registry options.
+func loadRegistryReport(flags *pflag.FlagSet) (*registryReport, error) {
+	if outputFormat != "text" && outputFormat != "json" {
+		return nil, fmt.Errorf("output must be text or json")
+	}
+
+	list, err := loadRunOptions(configFile, flags, runOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := singleRegistry(list)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := opts.Token.client(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := doc.GetRegistry()
+	if err != nil {
+		return nil, fmt.Errorf("could not get registry: %w", err)
+	}
+
+	subscription, err := doc.GetSubscription()
+	if err != nil {
+		return nil, fmt.Errorf("could not get subscription: %w", err)
+	}
+
+	repos, err := doc.ListRepositories(reg.Name)
+	if err != nil {
+		return nil, fmt.Errorf("could not list repositories: %w", err)
+	}
+
+	gc, err := doc.LastGarbageCollection(reg.Name)
+	if err != nil {
+		return nil, fmt.Errorf("could not get garbage collections: %w", err)
+	}
+
+	report := &registryReport{
+		Name:                  reg.Name,
+		Region:                reg.Region,
+		CreatedAt:             reg.CreatedAt,
+		Tier:                  subscription.Tier.Slug,
+		StorageUsageBytes:     reg.StorageUsageBytes,
+		StorageLimitBytes:     subscription.Tier.IncludedStorageBytes,
+		StorageUsageUpdatedAt: reg.StorageUsageBytesUpdatedAt,
+		AllowStorageOverage:   subscription.Tier.AllowStorageOverage,
+		Repositories:          len(repos),
+		RepositoryLimit:       subscription.Tier.IncludedRepositories,
+		LastGarbageCollection: gc,
+	}
+
+	if report.StorageLimitBytes > 0 {
+		report.StorageUsagePercent = float64(report.StorageUsageBytes) * 100 / float64(report.StorageLimitBytes)
+	}
+
+	return report, nil
+}
+
+func printRegistryUsage(report *registryReport) {
+	fmt.Printf("Storage: %s of %s\n", formatUsage(report.StorageUsageBytes, report.StorageLimitBytes), cleanup.FormatBytes(report.StorageLimitBytes))
+	fmt.Printf("Storage updated: %s\n", report.StorageUsageUpdatedAt.Format(time.RFC3339))
+
+	if report.RepositoryLimit > 0 {
+		fmt.Printf("Repositories: %d of %d\n", report.Repositories, report.RepositoryLimit)
+	} else {
+		fmt.Printf("Repositories: %d\n", report.Repositories)
+	}
+
+	if gc := report.LastGarbageCollection; gc != nil {
+		fmt.Printf("Last garbage collection: %s\t%s\tfreed %s\n", gc.CreatedAt.Format(time.RFC3339), gc.Status, cleanup.FormatBytes(gc.FreedBytes))
+	} else {
+		fmt.Println("Last garbage collection: never")
+	}
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func init() {
+	addRegistryFlags(registryCmd.PersistentFlags())
+	registryCmd.PersistentFlags().StringVar(&outputFormat, "output", "text", "Output format: text or json")
+	registryUsageCmd.Flags().Float64Var(&warnAbove, "warn-above", 0, "Exit with an error when storage usage is above the percentage of the tier limit")
+
+	registryCmd.AddCommand(registryInfoCmd)
+	registryCmd.AddCommand(registryUsageCmd)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/distribution"
+	"digitalocean-registry-cleaner/pkg/quarantine"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreRunID string
+	restoreState string
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore quarantined tags",
+	Long:  `Command re-creates tags deleted by the run [run] pointing to their manifests, which works until garbage collection removes the manifests.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := loadRunOptions(configFile, cmd.Flags(), runOpts)
+		if err != nil {
+			return err
+		}
+
+		state, err := quarantine.Load(restoreState)
+		if err != nil {
+			return err
+		}
+
+		indexes := state.Run(restoreRunID)
+		if len(indexes) == 0 {
+			return fmt.Errorf("no quarantined tags of run %s", restoreRunID)
+		}
+
+		// every registry of the config is restored with its own token
+		clients := map[string]*distribution.Client{}
+
+		var errs []error
+		for _, i := range indexes {
+			entry := &state.Entries[i]
+
+			client, ok := clients[entry.Registry]
+			if !ok {
+				client, err = restoreClient(list, entry.Registry)
+				if err != nil {
+					return err
+				}
+				clients[entry.Registry] = client
+			}
+
+			err := client.Tag(entry.Registry+"/"+entry.Repository, entry.Tag, entry.Digest)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not restore tag %s.%s:%s : %w", entry.Registry, entry.Repository, entry.Tag, err))
+				continue
+			}
+
+			restoredAt := time.Now().UTC()
+			entry.RestoredAt = &restoredAt
+			fmt.Printf("Restored tag: %s/%s:%s\t%s\n", entry.Registry, entry.Repository, entry.Tag, entry.Digest)
+		}
+
+		if err := state.Save(restoreState); err != nil {
+			errs = append(errs, err)
+		}
+
+		return errors.Join(errs...)
+	},
+}
+
+func init() {
+	restoreCmd.Flags().StringVar(&restoreRunID, "run", "", "ID of the run to restore")
+	restoreCmd.Flags().StringVar(&restoreState, "quarantine-state", "", "State file with the quarantined tags")
+	restoreCmd.Flags().StringVar(&configFile, "config", "", "YAML config file with the token sources of the registries")
+	restoreCmd.Flags().StringVar(&runOpts.RegistryHost, "registry-host", distribution.DefaultHost, "Container registry host")
+
+	_ = restoreCmd.MarkFlagRequired("run")
+	_ = restoreCmd.MarkFlagRequired("quarantine-state")
+}
+
+// restoreClient returns a Docker Registry v2 client authenticated by the token source of the registry.
+func restoreClient(list []*runOptions, registry string) (*distribution.Client, error) {
+	opts, err := registryOptions(list, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := opts.Token.orGlobal().token()
+	if err != nil {
+		return nil, err
+	}
+
+	return distribution.NewClient(opts.RegistryHost, token), nil
+}
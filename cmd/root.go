@@ -1,24 +1,95 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/do"
+	"digitalocean-registry-cleaner/pkg/lock"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	logLevel  string
+	logFormat string
+)
+
 var rootCmd = &cobra.Command{
 	Use:   "dorc",
 	Short: "DigitalOcean Registry Cleaner",
 	Long:  `A CLI tool to clean up unused images in DigitalOcean Container Registry.`,
+	// errors of the commands are not usage errors, the usage is shown by --help
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := newLogger(logLevel, logFormat)
+		if err != nil {
+			return err
+		}
+		slog.SetDefault(logger)
+		return nil
+	},
 }
 
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		fmt.Println("There was an error:", err)
+		fmt.Fprintln(os.Stderr, "There was an error:", err)
+		switch {
+		case do.IsUnauthorized(err):
+			fmt.Fprintln(os.Stderr, "Hint: the token is invalid or expired, run `dorc check` to verify the configuration")
+		case do.IsForbidden(err):
+			fmt.Fprintln(os.Stderr, "Hint: the token lacks the registry read or delete scope, run `dorc check` to verify the configuration")
+		}
+		if errors.Is(err, cleanup.ErrSafetyLimit) {
+			os.Exit(3) // distinct from other failures so that alerts can tell a refused run
+		}
+		if errors.Is(err, lock.ErrLocked) {
+			os.Exit(4) // another run is in progress
+		}
+		os.Exit(1)
+	}
+}
+
+// newLogger creates a logger writing to stderr, the human readable report goes to stdout.
+func newLogger(level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log-level must be debug, info, warn or error")
+	}
+
+	options := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, options)), nil
+	default:
+		return nil, fmt.Errorf("log-format must be text or json")
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Log format: text or json")
+	rootCmd.PersistentFlags().StringVar(&globalToken.File, "token-file", "", "File with the DigitalOcean API token, reloaded when it changes (default DO_TOKEN)")
+	rootCmd.PersistentFlags().StringVar(&globalToken.DoctlContext, "doctl-context", "", "Read the token of the doctl auth context (current uses the current context)")
+	rootCmd.PersistentFlags().StringVar(&globalToken.Command, "token-command", "", "Credential helper command printing the token to stdout, run with sh -c")
+
 	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(registryCmd)
+	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(gcCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(apiCmd)
+	rootCmd.AddCommand(explainCmd)
+	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(forecastCmd)
+	rootCmd.AddCommand(pinCmd)
+	rootCmd.AddCommand(unpinCmd)
+	rootCmd.AddCommand(pinsCmd)
 }
@@ -1,24 +1,102 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/detect"
+	"digitalocean-registry-cleaner/pkg/distribution"
 	"digitalocean-registry-cleaner/pkg/do"
+	"digitalocean-registry-cleaner/pkg/metrics"
+	"digitalocean-registry-cleaner/pkg/notify"
+	"digitalocean-registry-cleaner/pkg/runner"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
-var (
-	registry     string
-	repositories []string
-	protected    []string
+// guardOptions override the safety limits of a repository, nil values keep the global limits.
+type guardOptions struct {
+	MaxDeletePercent *float64 `yaml:"maxDeletePercent"`
+	MaxDelete        *int     `yaml:"maxDelete"`
+	MinRemaining     *int     `yaml:"minRemaining"`
+}
+
+// runOptions configures a cleanup run. Options are set by flags or loaded from a config file,
+// the yaml tag is the config key and the flag tag the name of the flag overriding it.
+type runOptions struct {
+	// Registries are cleaned up in a single run, each entry overrides the options of the config file.
+	Registries []yaml.Node `yaml:"registries"`
+	// Token is the source of the API token of the registry.
+	Token tokenSource `yaml:"token"`
+
+	Registry     string   `yaml:"registry" flag:"registry"`
+	Repositories []string `yaml:"repositories" flag:"repository"`
+	Protected    []string `yaml:"protect" flag:"protect"`
+
+	KeepTags   int `yaml:"keepTags" flag:"keep-tags"`
+	MinAgeDays int `yaml:"minAgeDays" flag:"min-age-days"`
+
+	KeepBranches       int `yaml:"keepBranches" flag:"keep-branches"`
+	MaxBranchesAgeDays int `yaml:"maxBranchesAgeDays" flag:"max-branches-age-days"`
+
+	PRPattern    string `yaml:"prPattern" flag:"pr-pattern"`
+	PRMaxAgeDays int    `yaml:"prMaxAgeDays" flag:"pr-max-age-days"`
+	// OpenPRs are open pull requests, nil if they are unknown.
+	OpenPRs     []int  `yaml:"openPRs" flag:"open-pr"`
+	OpenPRsFile string `yaml:"openPRsFile" flag:"open-prs-file"`
+
+	TargetUsage string `yaml:"targetUsage" flag:"target-usage"`
+
+	AuditLog string `yaml:"auditLog" flag:"audit-log"`
+
+	QuarantineState string `yaml:"quarantineState" flag:"quarantine-state"`
 
-	keepTags   int
-	minAgeDays int
+	Lock           string        `yaml:"lock" flag:"lock"`
+	LockStaleAfter time.Duration `yaml:"lockStaleAfter" flag:"lock-stale-after"`
 
-	dryRun bool
+	Pins string `yaml:"pins" flag:"pins"`
+
+	// S3Endpoint and S3Region configure the storage of s3:// audit logs, locks and pins.
+	S3Endpoint string `yaml:"s3Endpoint" flag:"s3-endpoint"`
+	S3Region   string `yaml:"s3Region" flag:"s3-region"`
+
+	// Labels keeps tags by the labels of their images read from RegistryHost.
+	Labels       bool   `yaml:"labels" flag:"labels"`
+	RegistryHost string `yaml:"registryHost" flag:"registry-host"`
+
+	NotifyWebhooks []string `yaml:"notifyWebhooks" flag:"notify-webhook"`
+	NotifySlack    []string `yaml:"notifySlack" flag:"notify-slack"`
+	NotifyTeams    []string `yaml:"notifyTeams" flag:"notify-teams"`
+	NotifyTemplate string   `yaml:"notifyTemplate" flag:"notify-template"`
+	NotifyOn       string   `yaml:"notifyOn" flag:"notify-on"`
+
+	PushgatewayURL string `yaml:"pushgatewayUrl" flag:"pushgateway-url"`
+	PushgatewayJob string `yaml:"pushgatewayJob" flag:"pushgateway-job"`
+
+	MaxDeletePercent float64 `yaml:"maxDeletePercent" flag:"max-delete-percent"`
+	MaxDelete        int     `yaml:"maxDelete" flag:"max-delete"`
+	MinRemaining     int     `yaml:"minRemaining" flag:"min-remaining"`
+	// Guards override the safety limits by repository.
+	Guards map[string]guardOptions `yaml:"guards"`
+	Force  bool                    `yaml:"force" flag:"force"`
+
+	Explain bool `yaml:"explain" flag:"explain"`
+	DryRun  bool `yaml:"dryRun" flag:"dry-run"`
+}
+
+var (
+	runOpts    runOptions
+	configFile string
 
 	protectedDefault = []string{
 		"latest",
@@ -34,64 +112,478 @@ var runCmd = &cobra.Command{
 	Short: "Run Cleaner",
 	Long:  `Command deletes tags older than [min-age-days] in the registry except the last [keep-tags] tags per repository.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		token := os.Getenv("DO_TOKEN")
-		if token == "" {
-			return fmt.Errorf("DO_TOKEN is not set")
+		list, err := loadRunOptions(configFile, cmd.Flags(), runOpts)
+		if err != nil {
+			return err
+		}
+
+		m := metrics.New()
+		err = runAll(list, m)
+
+		if gateway := list[0].PushgatewayURL; gateway != "" {
+			if pushErr := m.Registry.Push(gateway, list[0].PushgatewayJob); pushErr != nil {
+				return errors.Join(err, fmt.Errorf("could not push metrics: %w", pushErr))
+			}
+		}
+
+		return err
+	},
+}
+
+func init() {
+	addRunFlags(runCmd.Flags())
+}
+
+// addRunFlags registers the flags of the run options.
+func addRunFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&configFile, "config", "", "YAML config file with the options, flags take precedence")
+	flags.StringVar(&runOpts.Registry, "registry", "", "Registry name")
+	flags.StringArrayVar(&runOpts.Repositories, "repository", []string{}, "Repository name")
+	flags.StringArrayVar(&runOpts.Protected, "protect", protectedDefault, "Protect tag/branch")
+	flags.IntVar(&runOpts.KeepTags, "keep-tags", 5, "How many tags to keep per repository")
+	flags.IntVar(&runOpts.MinAgeDays, "min-age-days", 30, "Minimum age of the tags to delete in days")
+	flags.IntVar(&runOpts.KeepBranches, "keep-branches", 0, "How many of the newest branch tags to keep per repository (0 keeps all)")
+	flags.IntVar(&runOpts.MaxBranchesAgeDays, "max-branches-age-days", 0, "Age of branch tags to delete in days (default min-age-days)")
+	flags.StringVar(&runOpts.PRPattern, "pr-pattern", detect.DefaultPullRequestPattern, "Pull request tag pattern, the first group is the PR number (empty disables the PR policy)")
+	flags.IntVar(&runOpts.PRMaxAgeDays, "pr-max-age-days", 0, "Age of pull request tags to delete in days (default min-age-days)")
+	flags.IntSliceVar(&runOpts.OpenPRs, "open-pr", []int{}, "Open pull request number, tags of other pull requests are deleted")
+	flags.StringVar(&runOpts.OpenPRsFile, "open-prs-file", "", "File with open pull request numbers, one per line")
+	flags.StringVar(&runOpts.TargetUsage, "target-usage", "", "Delete eligible tags from the oldest until storage usage falls below the target (e.g. 80% or 5GiB)")
+	flags.StringVar(&runOpts.AuditLog, "audit-log", "", "Append deletions as JSON Lines to a file, stdout (-) or an S3-compatible bucket (s3://bucket/prefix)")
+	flags.StringVar(&runOpts.QuarantineState, "quarantine-state", "", "Record deleted tags in the state file so they can be restored until garbage collection")
+	flags.StringVar(&runOpts.Lock, "lock", "", "Run lock preventing overlapping runs: a lock file, a Kubernetes Lease (lease://namespace/name) or an S3-compatible object (s3://bucket/key)")
+	flags.DurationVar(&runOpts.LockStaleAfter, "lock-stale-after", 6*time.Hour, "Time since a run lock was renewed after which it is taken over as its holder probably crashed (0 never takes over)")
+	addPinsFlag(flags)
+	addS3Flags(flags)
+	flags.BoolVar(&runOpts.Labels, "labels", false, "Keep tags whose image has the label dorc.keep=true or dorc.expires=<date> in the future, read from the registry for tags about to be deleted")
+	flags.StringVar(&runOpts.RegistryHost, "registry-host", distribution.DefaultHost, "Container registry host the image labels are read from")
+	flags.StringArrayVar(&runOpts.NotifyWebhooks, "notify-webhook", []string{}, "URL receiving the run summary as JSON")
+	flags.StringArrayVar(&runOpts.NotifySlack, "notify-slack", []string{}, "Slack-compatible incoming webhook URL")
+	flags.StringArrayVar(&runOpts.NotifyTeams, "notify-teams", []string{}, "Microsoft Teams incoming webhook URL")
+	flags.StringVar(&runOpts.NotifyTemplate, "notify-template", "", "File with a Go template of the notification message")
+	flags.StringVar(&runOpts.NotifyOn, "notify-on", string(notify.Deletions), "When to notify: always, deletions (or failures) or failures")
+	flags.StringVar(&runOpts.PushgatewayURL, "pushgateway-url", "", "Prometheus Pushgateway URL the metrics are pushed to at the end of the run")
+	flags.StringVar(&runOpts.PushgatewayJob, "pushgateway-job", "dorc", "Job name of the pushed metrics")
+	flags.Float64Var(&runOpts.MaxDeletePercent, "max-delete-percent", 0, "Refuse to delete more than this percentage of the tags of a repository (0 disables)")
+	flags.IntVar(&runOpts.MaxDelete, "max-delete", 0, "Refuse to delete more than this number of tags of a repository (0 disables)")
+	flags.IntVar(&runOpts.MinRemaining, "min-remaining", 0, "Refuse to leave fewer than this number of tags in a repository (0 disables)")
+	flags.BoolVar(&runOpts.Force, "force", false, "Delete tags even if the safety limits are exceeded")
+	flags.BoolVar(&runOpts.Explain, "explain", false, "Print the decision of the retention policy for every tag")
+	flags.BoolVar(&runOpts.DryRun, "dry-run", false, "Dry run")
+}
+
+// runAll cleans up every registry and prints a combined report of several registries.
+// A failed registry does not stop the cleanup of the others.
+func runAll(list []*runOptions, m *metrics.Metrics) error {
+	var errs []error
+	var summaries []*notify.Summary
+	for _, opts := range list {
+		summary, err := runCleanup(opts, m)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("registry %s: %w", opts.Registry, err))
+			if summary == nil {
+				summary = &notify.Summary{Registry: opts.Registry, DryRun: opts.DryRun}
+				summary.Fail(err)
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	if len(list) > 1 {
+		fmt.Print("==> Summary\n\n")
+		for _, summary := range summaries {
+			result := "ok"
+			if len(summary.Failures) > 0 {
+				result = "failed: " + strings.Join(summary.Failures, "; ")
+			}
+			fmt.Printf("Registry: %s\tdeleted %d tags\talready gone %d\tfreed %s\t%s\n", summary.Registry, summary.Deleted, summary.Gone, cleanup.FormatBytes(summary.FreedBytes), result)
+		}
+		fmt.Println("=====")
+	}
+
+	return errors.Join(errs...)
+}
+
+// runCleanup cleans up the repositories of the registry, records metrics and notifies about the result.
+func runCleanup(opts *runOptions, m *metrics.Metrics) (*notify.Summary, error) {
+	if len(opts.Repositories) == 0 {
+		return nil, fmt.Errorf("at least one repository is required")
+	}
+
+	policy, err := cleanupPolicy(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var target cleanup.UsageTarget
+	if opts.TargetUsage != "" {
+		target, err = cleanup.ParseUsageTarget(opts.TargetUsage)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	notifiers, err := newNotifiers(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := registryClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	doc.OnRequest(m.ObserveRequest)
+
+	run, err := runner.Start(doc, runConfig(opts, notifiers, m), opts.Repositories)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []do.CleanupInput
+	for _, repository := range opts.Repositories {
+		input := policy
+		input.Repository = repository
+		input.Guard = guardFor(opts, repository)
+		inputs = append(inputs, input)
+	}
+
+	err = executeCleanup(doc, run, opts, inputs, target)
+	run.Finish(err)
+
+	return run.Summary, err
+}
+
+// runConfig returns the configuration of the cleanup runs of the options.
+func runConfig(opts *runOptions, notifiers []notify.Notifier, m *metrics.Metrics) runner.Config {
+	hostname, _ := os.Hostname()
+	return runner.Config{
+		Registry:        opts.Registry,
+		DryRun:          opts.DryRun,
+		Lock:            opts.Lock,
+		LockHolder:      fmt.Sprintf("%s/%d", hostname, os.Getpid()),
+		LockStaleAfter:  opts.LockStaleAfter,
+		AuditLog:        opts.AuditLog,
+		QuarantineState: opts.QuarantineState,
+		S3:              s3Config(opts),
+		Notifiers:       notifiers,
+		NotifyOn:        notify.Threshold(opts.NotifyOn),
+		Metrics:         m,
+	}
+}
+
+// cleanupPolicy validates the options and returns the cleanup input of the registry without a repository.
+func cleanupPolicy(opts *runOptions) (do.CleanupInput, error) {
+	var err error
+
+	if opts.Registry == "" {
+		return do.CleanupInput{}, fmt.Errorf("registry is required")
+	}
+
+	if opts.KeepTags < 1 {
+		return do.CleanupInput{}, fmt.Errorf("keep-tags must be greater than 0")
+	}
+
+	if opts.MinAgeDays < 1 {
+		return do.CleanupInput{}, fmt.Errorf("min-age-days must be greater than 0")
+	}
+
+	if opts.KeepBranches < 0 {
+		return do.CleanupInput{}, fmt.Errorf("keep-branches must not be negative")
+	}
+
+	if opts.MaxBranchesAgeDays < 0 {
+		return do.CleanupInput{}, fmt.Errorf("max-branches-age-days must not be negative")
+	}
+
+	if opts.PRMaxAgeDays < 0 {
+		return do.CleanupInput{}, fmt.Errorf("pr-max-age-days must not be negative")
+	}
+
+	if opts.MaxDeletePercent < 0 || opts.MaxDeletePercent > 100 {
+		return do.CleanupInput{}, fmt.Errorf("max-delete-percent must be between 0 and 100")
+	}
+
+	if opts.MaxDelete < 0 || opts.MinRemaining < 0 {
+		return do.CleanupInput{}, fmt.Errorf("max-delete and min-remaining must not be negative")
+	}
+
+	var prRegexp *regexp.Regexp
+	if opts.PRPattern != "" {
+		prRegexp, err = regexp.Compile(opts.PRPattern)
+		if err != nil {
+			return do.CleanupInput{}, fmt.Errorf("invalid pr-pattern: %w", err)
+		}
+		if prRegexp.NumSubexp() < 1 {
+			return do.CleanupInput{}, fmt.Errorf("pr-pattern must contain a capture group with the pull request number")
+		}
+	}
+
+	open := opts.OpenPRs
+	if opts.OpenPRsFile != "" {
+		fromFile, err := readOpenPRs(opts.OpenPRsFile)
+		if err != nil {
+			return do.CleanupInput{}, fmt.Errorf("could not read open-prs-file: %w", err)
+		}
+		open = append(append([]int{}, open...), fromFile...)
+	}
+
+	return do.CleanupInput{
+		Registry: opts.Registry,
+		DryRun:   opts.DryRun,
+		Policy: cleanup.Policy{
+			KeepTags:     opts.KeepTags,
+			MinAge:       time.Duration(opts.MinAgeDays) * 24 * time.Hour,
+			KeepBranches: opts.KeepBranches,
+			MaxBranchAge: time.Duration(opts.MaxBranchesAgeDays) * 24 * time.Hour,
+			PRPattern:    prRegexp,
+			PRMaxAge:     time.Duration(opts.PRMaxAgeDays) * 24 * time.Hour,
+			OpenPRs:      open,
+			Guard:        guardFor(opts, ""),
+			Force:        opts.Force,
+		},
+	}, nil
+}
+
+// registryClient returns the client of the registry consulting the pins and image labels of the options.
+func registryClient(opts *runOptions) (*do.DigitalOceanClient, error) {
+	doc, err := opts.Token.client(opts.Protected)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Labels {
+		token, err := opts.Token.orGlobal().token()
+		if err != nil {
+			return nil, err
 		}
+		images := distribution.NewClient(opts.RegistryHost, token)
+		doc.SetLabels(func(registry, repository, digest string) (map[string]string, error) {
+			labels, err := images.Labels(registry+"/"+repository, digest)
+			if errors.Is(err, distribution.ErrNotFound) {
+				return nil, nil // deleted meanwhile
+			}
+			return labels, err
+		})
+	}
 
-		if keepTags < 1 {
-			return fmt.Errorf("keep-tags must be greater than 0")
+	if opts.Pins != "" {
+		store, err := openPins(opts)
+		if err != nil {
+			return nil, err
 		}
+		doc.SetPins(pinSource(store))
+	}
+
+	return doc, nil
+}
+
+// guardFor returns the safety limits of the repository.
+func guardFor(opts *runOptions, repository string) cleanup.Guard {
+	guard := cleanup.Guard{
+		MaxDeletePercent: opts.MaxDeletePercent,
+		MaxDelete:        opts.MaxDelete,
+		MinRemaining:     opts.MinRemaining,
+	}
 
-		if minAgeDays < 1 {
-			return fmt.Errorf("min-age-days must be greater than 0")
+	if override, ok := opts.Guards[repository]; ok {
+		if override.MaxDeletePercent != nil {
+			guard.MaxDeletePercent = *override.MaxDeletePercent
 		}
+		if override.MaxDelete != nil {
+			guard.MaxDelete = *override.MaxDelete
+		}
+		if override.MinRemaining != nil {
+			guard.MinRemaining = *override.MinRemaining
+		}
+	}
+
+	return guard
+}
 
-		doc := do.NewClient(
-			token,
-			protected,
+// executeCleanup plans and executes the cleanup of all repositories in the run.
+func executeCleanup(doc *do.DigitalOceanClient, run *runner.Run, opts *runOptions, inputs []do.CleanupInput, target cleanup.UsageTarget) error {
+	if opts.DryRun {
+		fmt.Print("==> Dry run mode\n\n")
+	}
+
+	var plans []*cleanup.Decisions
+	for _, input := range inputs {
+		plan, err := doc.PlanCleanup(input)
+		if err != nil {
+			err = fmt.Errorf("cleanup failed: %w", err)
+			run.Summary.Add(notify.RepositorySummary{Repository: input.Repository, Error: err.Error()})
+			return err
+		}
+		slog.Info("planned cleanup",
+			"registry", plan.Registry,
+			"repository", plan.Repository,
+			"tags", len(plan.Tags),
+			"protected", len(plan.Protected),
+			"pinned", len(plan.Pinned),
+			"labeled", len(plan.Labeled),
+			"delete", len(plan.Delete),
 		)
+		plans = append(plans, plan)
+	}
+
+	if opts.TargetUsage != "" {
+		if err := selectForTarget(doc, opts.Registry, plans, target); err != nil {
+			return fmt.Errorf("cleanup failed: %w", err)
+		}
+	}
 
-		if dryRun {
-			fmt.Print("==> Dry run mode\n\n")
+	if opts.Explain {
+		for _, plan := range plans {
+			printDecisions(plan)
 		}
+	}
+
+	if err := run.Check(plans); err != nil {
+		return fmt.Errorf("%w (use --force to override)", err)
+	}
 
-		for _, repository := range repositories {
-			deleted, err := doc.RunCleanup(do.CleanupInput{
-				Registry:   registry,
-				Repository: repository,
-				DryRun:     dryRun,
-				KeepTags:   keepTags,
-				MinAge:     time.Duration(minAgeDays) * 24 * time.Hour,
-			})
+	if opts.QuarantineState != "" && !opts.DryRun {
+		fmt.Printf("Run ID: %s (restore with: dorc restore --run %s)\n\n", run.Summary.RunID, run.Summary.RunID)
+	}
+
+	for _, plan := range plans {
+		deleted, err := run.Execute(plan)
 
-			if len(deleted) > 0 {
-				fmt.Println(fmt.Sprintf("Registry: %s", registry))
-				fmt.Println(fmt.Sprintf("Repository: %s\n", repository))
+		if len(deleted) > 0 || len(plan.Gone) > 0 {
+			fmt.Println(fmt.Sprintf("Registry: %s", plan.Registry))
+			fmt.Println(fmt.Sprintf("Repository: %s\n", plan.Repository))
 
-				for _, tag := range deleted {
-					fmt.Printf("Deleted tag: %s\t%s\n", tag.Tag, tag.UpdatedAt.Format(time.RFC3339))
-				}
-				fmt.Println("=====")
+			for _, tag := range deleted {
+				fmt.Printf("Deleted tag: %s\t%s\n", tag.Tag, tag.UpdatedAt.Format(time.RFC3339))
+			}
+			for _, tag := range plan.Gone {
+				fmt.Printf("Already gone: %s\t%s\n", tag.Tag, tag.UpdatedAt.Format(time.RFC3339))
 			}
+			fmt.Println("=====")
+		}
 
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newNotifiers creates the notifiers configured by the options.
+func newNotifiers(opts *runOptions) ([]notify.Notifier, error) {
+	switch notify.Threshold(opts.NotifyOn) {
+	case notify.Always, notify.Deletions, notify.Failures:
+	default:
+		return nil, fmt.Errorf("notify-on must be always, deletions or failures")
+	}
+
+	var tmpl string
+	if opts.NotifyTemplate != "" {
+		content, err := os.ReadFile(opts.NotifyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("could not read notify-template: %w", err)
+		}
+		tmpl = string(content)
+	}
+
+	var notifiers []notify.Notifier
+	for kind, urls := range map[string][]string{
+		"webhook": opts.NotifyWebhooks,
+		"slack":   opts.NotifySlack,
+		"teams":   opts.NotifyTeams,
+	} {
+		for _, url := range urls {
+			notifier, err := notify.NewWebhook(kind, url, tmpl)
 			if err != nil {
-				return fmt.Errorf("cleanup failed: %w", err)
+				return nil, err
 			}
+			notifiers = append(notifiers, notifier)
 		}
+	}
 
-		return nil
-	},
+	return notifiers, nil
 }
 
-func init() {
-	runCmd.Flags().StringVar(&registry, "registry", "", "Registry name")
-	runCmd.Flags().StringArrayVar(&repositories, "repository", []string{}, "Repository name")
-	runCmd.Flags().StringArrayVar(&protected, "protect", protectedDefault, "Protect tag/branch")
-	runCmd.Flags().IntVar(&keepTags, "keep-tags", 5, "How many tags to keep per repository")
-	runCmd.Flags().IntVar(&minAgeDays, "min-age-days", 30, "Minimum age of the tags to delete in days")
-	runCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Dry run")
-
-	_ = runCmd.MarkFlagRequired("registry")
-	_ = runCmd.MarkFlagRequired("repository")
+// selectForTarget adds eligible tags to the plans until the projected storage usage of the registry
+// falls below the target and reports the projected result.
+func selectForTarget(doc *do.DigitalOceanClient, registry string, plans []*cleanup.Decisions, target cleanup.UsageTarget) error {
+	reg, err := doc.GetRegistry()
+	if err != nil {
+		return fmt.Errorf("could not get registry: %w", err)
+	}
+
+	if reg.Name != registry {
+		return fmt.Errorf("storage usage is reported for registry %s, not %s", reg.Name, registry)
+	}
+
+	subscription, err := doc.GetSubscription()
+	if err != nil {
+		return fmt.Errorf("could not get subscription: %w", err)
+	}
+
+	limit := subscription.Tier.IncludedStorageBytes
+	targetBytes, err := target.Resolve(limit)
+	if err != nil {
+		return err
+	}
+
+	projected := cleanup.SelectForTarget(plans, reg.StorageUsageBytes, targetBytes)
+
+	fmt.Printf("Storage usage: %s of %s\n", formatUsage(reg.StorageUsageBytes, limit), cleanup.FormatBytes(limit))
+	fmt.Printf("Target usage: %s\n", formatUsage(targetBytes, limit))
+	fmt.Printf("Projected usage: %s (after garbage collection)\n", formatUsage(projected, limit))
+	if projected > targetBytes {
+		fmt.Println("Warning: target usage cannot be reached without deleting protected or retained tags")
+	}
+	fmt.Println("=====")
+
+	return nil
+}
+
+// printDecisions prints the decision about every tag of the plan, the newest first.
+func printDecisions(plan *cleanup.Decisions) {
+	tags := slices.Clone(plan.Tags)
+	slices.SortFunc(tags, func(a, b cleanup.Tag) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+
+	fmt.Printf("Registry: %s\n", plan.Registry)
+	fmt.Printf("Repository: %s\n\n", plan.Repository)
+	for _, tag := range tags {
+		decision := plan.ByTag[tag.Tag]
+		action := "keep"
+		if decision.Delete {
+			action = "delete"
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", tag.Tag, tag.UpdatedAt.Format(time.RFC3339), decision.Kind, action, decision.Explanation)
+	}
+	fmt.Println("=====")
+}
+
+// readOpenPRs reads pull request numbers separated by whitespace or commas.
+// Empty lines, lines starting with "//" and the "#" prefix of a number are ignored.
+func readOpenPRs(path string) ([]int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	prs := []int{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			number, err := strconv.Atoi(strings.TrimPrefix(field, "#"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid pull request number %q", field)
+			}
+			prs = append(prs, number)
+		}
+	}
+
+	return prs, nil
 }
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"os"
+
+	"digitalocean-registry-cleaner/pkg/s3"
+
+	"github.com/spf13/pflag"
+)
+
+// addS3Flags registers the flags of the S3-compatible storage of s3:// targets.
+func addS3Flags(flags *pflag.FlagSet) {
+	flags.StringVar(&runOpts.S3Endpoint, "s3-endpoint", "https://s3.amazonaws.com", "S3-compatible endpoint of s3:// targets")
+	flags.StringVar(&runOpts.S3Region, "s3-region", "us-east-1", "Region of the S3-compatible endpoint")
+}
+
+// s3Config returns the S3-compatible storage of the options, credentials are read from the environment.
+func s3Config(opts *runOptions) s3.Config {
+	return s3.Config{
+		Endpoint:  opts.S3Endpoint,
+		Region:    opts.S3Region,
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/metrics"
+	"digitalocean-registry-cleaner/pkg/schedule"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	serveConfig   string
+	serveSchedule string
+	metricsAddr   string
+	healthAddr    string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run Cleaner on a schedule",
+	Long:  `Command runs the cleanup with the options of the [config] file on the cron [schedule]. SIGHUP reloads the config file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sched, err := schedule.Parse(serveSchedule)
+		if err != nil {
+			return err
+		}
+
+		s := &server{metrics: metrics.New()}
+		if err := s.reload(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		servers, err := s.listen()
+		if err != nil {
+			return err
+		}
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+
+		s.ready.Store(true)
+		slog.Info("serving", "schedule", serveSchedule)
+
+		for {
+			next := sched.Next(time.Now())
+			if next.IsZero() {
+				return fmt.Errorf("schedule %q never fires", serveSchedule)
+			}
+			slog.Info("next run scheduled", "at", next)
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return s.shutdown(servers)
+			case <-hup:
+				timer.Stop()
+				if err := s.reload(); err != nil {
+					slog.Error("could not reload config, keeping the previous one", "config", serveConfig, "error", err)
+				} else {
+					slog.Info("reloaded config", "config", serveConfig)
+				}
+			case <-timer.C:
+				go s.run()
+			}
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveConfig, "config", "", "YAML config file with the run options")
+	serveCmd.Flags().StringVar(&serveSchedule, "schedule", "0 2 * * *", "Cron schedule of the cleanup runs")
+	serveCmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "Address serving Prometheus metrics on /metrics (e.g. :9090)")
+	serveCmd.Flags().StringVar(&healthAddr, "health-addr", ":8080", "Address serving /healthz and /readyz (empty disables)")
+
+	_ = serveCmd.MarkFlagRequired("config")
+}
+
+// server runs scheduled cleanups, runs never overlap.
+type server struct {
+	metrics *metrics.Metrics
+	ready   atomic.Bool
+
+	mu   sync.Mutex // guards opts
+	opts []*runOptions
+
+	running sync.Mutex // held while a cleanup runs
+}
+
+// reload loads the config file, the current options are kept on error.
+func (s *server) reload() error {
+	list, err := loadRunOptions(serveConfig, pflag.NewFlagSet("serve", pflag.ContinueOnError), runOpts)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.opts = list
+	s.mu.Unlock()
+	return nil
+}
+
+// run runs the cleanup unless the previous run is still in progress.
+func (s *server) run() {
+	if !s.running.TryLock() {
+		slog.Warn("previous run is still in progress, skipping")
+		return
+	}
+	defer s.running.Unlock()
+
+	s.mu.Lock()
+	list := s.opts
+	s.mu.Unlock()
+
+	if err := runAll(list, s.metrics); err != nil {
+		slog.Error("run failed", "error", err)
+	}
+
+	if gateway := list[0].PushgatewayURL; gateway != "" {
+		if err := s.metrics.Registry.Push(gateway, list[0].PushgatewayJob); err != nil {
+			slog.Error("could not push metrics", "gateway", gateway, "error", err)
+		}
+	}
+}
+
+// listen starts the metrics and health endpoints, they share a server when the addresses are equal.
+func (s *server) listen() ([]*http.Server, error) {
+	muxes := map[string]*http.ServeMux{}
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+
+	if metricsAddr != "" {
+		mux(metricsAddr).Handle("/metrics", s.metrics.Registry.Handler())
+	}
+
+	if healthAddr != "" {
+		mux(healthAddr).HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintln(w, "ok")
+		})
+		mux(healthAddr).HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+			if !s.ready.Load() {
+				http.Error(w, "not ready", http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = fmt.Fprintln(w, "ok")
+		})
+	}
+
+	var servers []*http.Server
+	for addr, handler := range muxes {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("could not listen on %s: %w", addr, err)
+		}
+
+		srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+		servers = append(servers, srv)
+		go func() {
+			if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("could not serve", "addr", addr, "error", err)
+			}
+		}()
+	}
+
+	return servers, nil
+}
+
+// shutdown waits for the running cleanup and stops the servers.
+func (s *server) shutdown(servers []*http.Server) error {
+	s.ready.Store(false)
+	slog.Info("shutting down, waiting for the running cleanup")
+	s.running.Lock()
+	defer s.running.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var errs []error
+	for _, srv := range servers {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
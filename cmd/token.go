@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/do"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tokenSource configures where the DigitalOcean API token is read from.
+// Only one of the sources may be set. A registry without a token source uses the token flags and DO_TOKEN
+// as the last resort.
+type tokenSource struct {
+	// Env is the name of the environment variable with the token.
+	Env string `yaml:"env"`
+	// File is the path of a file with the token, reloaded when the file changes.
+	File string `yaml:"file"`
+	// Secret is the mount path of a Kubernetes secret, the token is read from its Key (DO_TOKEN by default).
+	Secret string `yaml:"secret"`
+	Key    string `yaml:"key"`
+	// DoctlContext is the doctl auth context with the token, "current" uses the current context.
+	DoctlContext string `yaml:"doctlContext"`
+	// Command is a credential helper printing the token to stdout.
+	Command string `yaml:"command"`
+}
+
+// globalToken is the token source of the token flags.
+var globalToken tokenSource
+
+// orGlobal returns the global token source if the source is not configured.
+func (s tokenSource) orGlobal() tokenSource {
+	if s == (tokenSource{}) {
+		return globalToken
+	}
+	return s
+}
+
+// path returns the token file of the source, empty if the token is not read from a file.
+func (s tokenSource) path() string {
+	switch {
+	case s.File != "":
+		return s.File
+	case s.Secret != "":
+		key := s.Key
+		if key == "" {
+			key = "DO_TOKEN"
+		}
+		return filepath.Join(s.Secret, key)
+	default:
+		return ""
+	}
+}
+
+// validate rejects sources configuring several tokens, only one of them would be used.
+func (s tokenSource) validate() error {
+	var set []string
+	for name, value := range map[string]string{
+		"env":          s.Env,
+		"file":         s.File,
+		"secret":       s.Secret,
+		"doctlContext": s.DoctlContext,
+		"command":      s.Command,
+	} {
+		if value != "" {
+			set = append(set, name)
+		}
+	}
+	if len(set) > 1 {
+		slices.Sort(set)
+		return fmt.Errorf("token sets %s, only one token source is allowed", strings.Join(set, " and "))
+	}
+	return nil
+}
+
+// token returns the API token of the source.
+func (s tokenSource) token() (string, error) {
+	if err := s.validate(); err != nil {
+		return "", err
+	}
+
+	switch {
+	case s.Env != "":
+		token := os.Getenv(s.Env)
+		if token == "" {
+			return "", fmt.Errorf("%s is not set", s.Env)
+		}
+		return token, nil
+	case s.path() != "":
+		return readToken(s.path())
+	case s.DoctlContext != "":
+		return doctlToken(s.DoctlContext)
+	case s.Command != "":
+		return commandToken(s.Command)
+	default:
+		token := os.Getenv("DO_TOKEN")
+		if token == "" {
+			return "", fmt.Errorf("DO_TOKEN is not set")
+		}
+		return token, nil
+	}
+}
+
+// client creates a DigitalOcean client authenticated by the token source (or the global one),
+// a token read from a file is reloaded when the file changes.
+func (s tokenSource) client(protected []string) (*do.DigitalOceanClient, error) {
+	s = s.orGlobal()
+
+	token, err := s.token()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := do.NewClient(token, protected)
+	if path := s.path(); path != "" {
+		doc.SetTokenSource((&fileToken{path: path}).get)
+	}
+
+	return doc, nil
+}
+
+// readToken reads a token from the file, surrounding whitespace is ignored.
+func readToken(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read token: %w", err)
+	}
+
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// fileToken reads a token from a file and reloads it when the file changes, e.g. when a mounted secret is rotated.
+type fileToken struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	token   string
+}
+
+func (f *fileToken) get() (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("could not read token: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.token != "" && info.ModTime().Equal(f.modTime) {
+		return f.token, nil
+	}
+
+	token, err := readToken(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	f.token, f.modTime = token, info.ModTime()
+	return token, nil
+}
+
+// doctlToken returns the token of the doctl auth context.
+func doctlToken(context string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find doctl config: %w", err)
+	}
+
+	path := filepath.Join(dir, "doctl", "config.yaml")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read doctl config: %w", err)
+	}
+
+	var config struct {
+		AccessToken  string            `yaml:"access-token"`
+		Context      string            `yaml:"context"`
+		AuthContexts map[string]string `yaml:"auth-contexts"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return "", fmt.Errorf("could not parse doctl config %s: %w", path, err)
+	}
+
+	if context == "current" {
+		context = config.Context
+	}
+
+	token := config.AuthContexts[context]
+	if context == "" || context == "default" {
+		token = config.AccessToken
+	}
+
+	if token == "" {
+		return "", fmt.Errorf("doctl config %s has no token of context %q", path, context)
+	}
+	return token, nil
+}
+
+// commandToken runs the credential helper with sh -c and returns the token printed to stdout,
+// so the command may quote its arguments or use pipes.
+func commandToken(command string) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", fmt.Errorf("token command is empty")
+	}
+
+	output, err := exec.Command("sh", "-c", command).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("token command failed: %w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("token command failed: %w", err)
+	}
+
+	token := strings.TrimSpace(string(output))
+	if token == "" {
+		return "", fmt.Errorf("token command printed no token")
+	}
+	return token, nil
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenSource_Token(t *testing.T) {
+	t.Setenv("TEAM_A", "env-token")
+	t.Setenv("DO_TOKEN", "default-token")
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("file-token\n"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "DO_TOKEN"), []byte("secret-token"), 0o600))
+
+	for name, tc := range map[string]struct {
+		source tokenSource
+		token  string
+	}{
+		"env":     {source: tokenSource{Env: "TEAM_A"}, token: "env-token"},
+		"file":    {source: tokenSource{File: filepath.Join(dir, "token")}, token: "file-token"},
+		"secret":  {source: tokenSource{Secret: dir}, token: "secret-token"},
+		"command": {source: tokenSource{Command: "echo 'command token' | tr ' ' -"}, token: "command-token"},
+		"default": {source: tokenSource{}, token: "default-token"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			token, err := tc.source.token()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.token, token)
+		})
+	}
+}
+
+func TestTokenSource_SeveralSources(t *testing.T) {
+	t.Setenv("TEAM_B", "env-token")
+
+	_, err := tokenSource{Env: "TEAM_B", File: "/secrets/a"}.token()
+	assert.ErrorContains(t, err, "token sets env and file, only one token source is allowed")
+
+	_, err = tokenSource{Env: "TEAM_B", File: "/secrets/a"}.client(nil)
+	assert.Error(t, err)
+}
+
+func TestTokenSource_OrGlobal(t *testing.T) {
+	defer func(global tokenSource) { globalToken = global }(globalToken)
+	globalToken = tokenSource{Command: "echo global"}
+
+	assert.Equal(t, globalToken, tokenSource{}.orGlobal())
+	assert.Equal(t, tokenSource{Env: "TEAM_A"}, tokenSource{Env: "TEAM_A"}.orGlobal())
+}
+
+func TestFileToken_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte("old"), 0o600))
+
+	source := &fileToken{path: path}
+	token, err := source.get()
+	assert.NoError(t, err)
+	assert.Equal(t, "old", token)
+
+	assert.NoError(t, os.WriteFile(path, []byte("new"), 0o600))
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	token, err = source.get()
+	assert.NoError(t, err)
+	assert.Equal(t, "new", token)
+}
@@ -0,0 +1,375 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/do"
+	"digitalocean-registry-cleaner/pkg/lock"
+	"digitalocean-registry-cleaner/pkg/runner"
+)
+
+// errPlanChanged is returned when the plan of a cleanup differs from the plan the client has seen.
+var errPlanChanged = errors.New("plan changed")
+
+// Registry is the part of the DigitalOcean client used by the server.
+type Registry interface {
+	runner.Client
+	ListRepositories(registry string) ([]do.Repository, error)
+	PlanCleanup(input do.CleanupInput) (*cleanup.Decisions, error)
+}
+
+// Token grants access to the repositories, "*" grants access to all of them.
+type Token struct {
+	Name         string   `yaml:"name"`
+	Token        string   `yaml:"token"`
+	Repositories []string `yaml:"repositories"`
+}
+
+// allows reports whether the token grants access to the repository.
+func (t Token) allows(repository string) bool {
+	return slices.Contains(t.Repositories, "*") || slices.Contains(t.Repositories, repository)
+}
+
+// Server serves the HTTP API, the repositories are cleaned up with the policy.
+type Server struct {
+	registry Registry
+	policy   do.CleanupInput
+	tokens   []Token
+	guard    func(repository string) cleanup.Guard
+	run      runner.Config
+
+	running sync.Mutex // cleanups of the server never overlap, the run lock protects against other hosts
+}
+
+// NewServer creates a server cleaning up repositories of policy.Registry with the policy.
+func NewServer(registry Registry, policy do.CleanupInput, tokens []Token) *Server {
+	return &Server{registry: registry, policy: policy, tokens: tokens}
+}
+
+// SetGuard sets the safety limits by repository, the guard of the policy applies by default.
+func (s *Server) SetGuard(guard func(repository string) cleanup.Guard) {
+	s.guard = guard
+}
+
+// SetRunConfig sets the run lock, audit log, quarantine state and notifications of cleanups.
+// The registry and the dry-run mode are those of the policy and the request.
+func (s *Server) SetRunConfig(config runner.Config) {
+	s.run = config
+}
+
+// TagInfo is a tag with its classification by the retention policy.
+type TagInfo struct {
+	Tag       string    `json:"tag"`
+	Digest    string    `json:"digest"`
+	SizeBytes int       `json:"size_bytes"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Kind is protected, pinned, labeled, release, branch or pull_request.
+	Kind string `json:"kind"`
+	// Action is keep or delete.
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	// Explanation is the decision of the retention policy.
+	Explanation string `json:"explanation"`
+}
+
+// Plan is the cleanup plan of a repository.
+type Plan struct {
+	// ID identifies the tags to delete, a cleanup request with the ID deletes exactly these tags.
+	ID         string    `json:"id"`
+	Registry   string    `json:"registry"`
+	Repository string    `json:"repository"`
+	Tags       []TagInfo `json:"tags"`
+	Delete     []string  `json:"delete"`
+	FreedBytes int64     `json:"freed_bytes"`
+}
+
+// CleanupRequest is the body of a cleanup request.
+type CleanupRequest struct {
+	DryRun bool `json:"dry_run"`
+	// PlanID is the ID of the plan to delete, the cleanup is refused if the plan changed meanwhile.
+	// Empty deletes the current plan.
+	PlanID string `json:"plan_id,omitempty"`
+}
+
+// CleanupResult is the outcome of a cleanup.
+type CleanupResult struct {
+	RunID      string   `json:"run_id,omitempty"`
+	Registry   string   `json:"registry"`
+	Repository string   `json:"repository"`
+	DryRun     bool     `json:"dry_run"`
+	Deleted    []string `json:"deleted"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Handler returns the handler of the API endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/repositories", s.authenticated(s.listRepositories))
+	mux.HandleFunc("GET /api/v1/repositories/{repository}/tags", s.authorized(s.listTags))
+	mux.HandleFunc("GET /api/v1/repositories/{repository}/plan", s.authorized(s.plan))
+	mux.HandleFunc("POST /api/v1/repositories/{repository}/cleanup", s.authorized(s.cleanup))
+	return mux
+}
+
+// authenticated passes the token of the bearer authorization header to the handler.
+func (s *Server) authenticated(next func(w http.ResponseWriter, r *http.Request, token Token)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && secret != "" {
+			for _, token := range s.tokens {
+				if subtle.ConstantTimeCompare([]byte(token.Token), []byte(secret)) == 1 {
+					next(w, r, token)
+					return
+				}
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="dorc"`)
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+	}
+}
+
+// authorized checks the token grants access to the repository of the request path.
+func (s *Server) authorized(next func(w http.ResponseWriter, r *http.Request, repository string)) http.HandlerFunc {
+	return s.authenticated(func(w http.ResponseWriter, r *http.Request, token Token) {
+		repository := r.PathValue("repository")
+		if !token.allows(repository) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("token has no access to repository %s", repository))
+			return
+		}
+		next(w, r, repository)
+	})
+}
+
+func (s *Server) listRepositories(w http.ResponseWriter, r *http.Request, token Token) {
+	repositories, err := s.registry.ListRepositories(s.policy.Registry)
+	if err != nil {
+		writeError(w, errorStatus(err), fmt.Errorf("could not list repositories: %w", err))
+		return
+	}
+
+	allowed := []do.Repository{}
+	for _, repository := range repositories {
+		if token.allows(repository.Name) {
+			allowed = append(allowed, repository)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, allowed)
+}
+
+func (s *Server) listTags(w http.ResponseWriter, r *http.Request, repository string) {
+	plan, err := s.registry.PlanCleanup(s.input(repository))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, classify(plan))
+}
+
+func (s *Server) plan(w http.ResponseWriter, r *http.Request, repository string) {
+	plan, err := s.registry.PlanCleanup(s.input(repository))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	result := Plan{
+		ID:         planID(plan),
+		Registry:   plan.Registry,
+		Repository: plan.Repository,
+		Tags:       classify(plan),
+		Delete:     cleanup.TagNames(plan.Delete),
+		FreedBytes: plan.EstimateFreedBytes(),
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) cleanup(w http.ResponseWriter, r *http.Request, repository string) {
+	var request CleanupRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+	}
+
+	if !s.running.TryLock() {
+		writeError(w, http.StatusConflict, errors.New("another cleanup is in progress"))
+		return
+	}
+	defer s.running.Unlock()
+
+	input := s.input(repository)
+	input.DryRun = input.DryRun || request.DryRun
+
+	config := s.run
+	config.Registry = input.Registry
+	config.DryRun = input.DryRun
+
+	result := CleanupResult{
+		Registry:   input.Registry,
+		Repository: repository,
+		DryRun:     input.DryRun,
+		Deleted:    []string{},
+	}
+
+	run, err := runner.Start(s.registry, config, []string{repository})
+	if err != nil {
+		result.Error = err.Error()
+		writeJSON(w, cleanupStatus(err), result)
+		return
+	}
+
+	deleted, err := s.execute(run, input, request.PlanID)
+	run.Finish(err)
+
+	result.RunID = run.Summary.RunID
+	result.Deleted = cleanup.TagNames(deleted)
+
+	status := http.StatusOK
+	if err != nil {
+		status = cleanupStatus(err)
+		result.Error = err.Error()
+	}
+
+	writeJSON(w, status, result)
+}
+
+// execute plans the cleanup of the input and deletes the tags of the plan in the run.
+// The plan is refused if its ID differs from the plan ID of the request.
+func (s *Server) execute(run *runner.Run, input do.CleanupInput, id string) ([]cleanup.Tag, error) {
+	plan, err := s.registry.PlanCleanup(input)
+	if err != nil {
+		return nil, fmt.Errorf("cleanup failed: %w", err)
+	}
+
+	if id != "" && id != planID(plan) {
+		return nil, fmt.Errorf("%w since plan %s was fetched, fetch the plan again", errPlanChanged, id)
+	}
+
+	if err := run.Check([]*cleanup.Decisions{plan}); err != nil {
+		return nil, err
+	}
+
+	return run.Execute(plan)
+}
+
+// cleanupStatus returns the status code of a failed cleanup.
+func cleanupStatus(err error) int {
+	var preflight *runner.PreflightError
+	switch {
+	case errors.Is(err, cleanup.ErrSafetyLimit):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, lock.ErrLocked), errors.Is(err, errPlanChanged):
+		return http.StatusConflict
+	case errors.As(err, &preflight):
+		return preflightStatus(preflight.Problems)
+	default:
+		return errorStatus(err)
+	}
+}
+
+// preflightStatus returns the status code of the worst problem of a failed pre-flight check: a failed API request,
+// a token problem, a misconfigured registry and finally missing repositories.
+func preflightStatus(problems []do.Problem) int {
+	status := http.StatusNotFound
+	for _, problem := range problems {
+		switch {
+		case problem.Err != nil:
+			return http.StatusBadGateway
+		case problem.Subject == "token":
+			status = http.StatusForbidden
+		case problem.Subject == "registry" && status != http.StatusForbidden:
+			status = http.StatusUnprocessableEntity
+		}
+	}
+	return status
+}
+
+// errorStatus returns the status code of a failed request to the DigitalOcean API.
+func errorStatus(err error) int {
+	switch {
+	case do.IsNotFound(err):
+		return http.StatusNotFound
+	case do.IsForbidden(err), do.IsUnauthorized(err):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// planID identifies the tags the plan deletes by their names and digests.
+func planID(plan *cleanup.Decisions) string {
+	tags := make([]string, 0, len(plan.Delete))
+	for _, tag := range plan.Delete {
+		tags = append(tags, tag.Tag+"@"+tag.ManifestDigest)
+	}
+	slices.Sort(tags)
+
+	sum := sha256.Sum256([]byte(strings.Join(tags, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// input returns the cleanup input of the repository.
+func (s *Server) input(repository string) do.CleanupInput {
+	input := s.policy
+	input.Repository = repository
+	if s.guard != nil {
+		input.Guard = s.guard(repository)
+	}
+	return input
+}
+
+// classify describes all tags of the plan, the newest first.
+func classify(plan *cleanup.Decisions) []TagInfo {
+	tags := make([]TagInfo, 0, len(plan.Tags))
+	for _, tag := range plan.Tags {
+		decision := plan.ByTag[tag.Tag]
+		info := TagInfo{
+			Tag:         tag.Tag,
+			Digest:      tag.ManifestDigest,
+			SizeBytes:   tag.CompressedSize,
+			UpdatedAt:   tag.UpdatedAt,
+			Kind:        decision.Kind,
+			Action:      "keep",
+			Explanation: decision.Explanation,
+		}
+
+		if decision.Delete {
+			info.Action = "delete"
+			info.Reason = string(plan.Reasons[tag.Tag])
+		}
+
+		tags = append(tags, info)
+	}
+
+	slices.SortFunc(tags, func(a, b TagInfo) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+
+	return tags
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
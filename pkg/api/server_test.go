@@ -0,0 +1,344 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/audit"
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/do"
+	"digitalocean-registry-cleaner/pkg/lock"
+	"digitalocean-registry-cleaner/pkg/quarantine"
+	"digitalocean-registry-cleaner/pkg/runner"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var kinds = map[string]string{"latest": cleanup.KindProtected, "1.0.0": cleanup.KindRelease, "pr-12": cleanup.KindPullRequest, "old-feature": cleanup.KindBranch}
+
+// fakeRegistry plans deletion of the tags named "old-*"
+type fakeRegistry struct {
+	tags     []cleanup.Tag
+	inputs   []do.CleanupInput
+	dryRuns  []bool
+	problems []do.Problem
+	err      error
+	// executing is called when the tags of a plan are deleted
+	executing func()
+}
+
+func (f *fakeRegistry) Preflight(registry string, repositories []string, write bool) []do.Problem {
+	return f.problems
+}
+
+func (f *fakeRegistry) ListRepositories(registry string) ([]do.Repository, error) {
+	return []do.Repository{
+		{RegistryName: registry, Name: "backend"},
+		{RegistryName: registry, Name: "frontend"},
+	}, nil
+}
+
+func (f *fakeRegistry) PlanCleanup(input do.CleanupInput) (*cleanup.Decisions, error) {
+	f.inputs = append(f.inputs, input)
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	plan := &cleanup.Decisions{Registry: input.Registry, Repository: input.Repository, Tags: f.tags, Reasons: map[string]cleanup.Reason{}, ByTag: map[string]cleanup.Decision{}, Guard: input.Guard}
+	for _, tag := range f.tags {
+		decision := cleanup.Decision{Tag: tag.Tag, Kind: kinds[tag.Tag], Explanation: "kept"}
+		if tag.Tag == "latest" {
+			plan.Protected = append(plan.Protected, tag)
+		}
+		if strings.HasPrefix(tag.Tag, "old-") {
+			plan.Delete = append(plan.Delete, tag)
+			plan.Reasons[tag.Tag] = cleanup.ReasonBranchAge
+			decision.Delete = true
+			decision.Explanation = "deleted"
+		}
+		plan.ByTag[tag.Tag] = decision
+	}
+	return plan, nil
+}
+
+func (f *fakeRegistry) ExecutePlan(plan *cleanup.Decisions, dryRun bool) ([]cleanup.Tag, error) {
+	f.dryRuns = append(f.dryRuns, dryRun)
+	if f.executing != nil {
+		f.executing()
+	}
+	if err := plan.Check(); err != nil {
+		return nil, err
+	}
+	return plan.Delete, nil
+}
+
+func newTestServer(registry *fakeRegistry) *httptest.Server {
+	return httptest.NewServer(newServer(registry).Handler())
+}
+
+func newServer(registry *fakeRegistry) *Server {
+	now := time.Now()
+	registry.tags = []cleanup.Tag{
+		{Tag: "latest", ManifestDigest: "sha256:a", CompressedSize: 10, UpdatedAt: now},
+		{Tag: "1.0.0", ManifestDigest: "sha256:b", CompressedSize: 20, UpdatedAt: now.Add(-time.Hour)},
+		{Tag: "pr-12", ManifestDigest: "sha256:c", CompressedSize: 30, UpdatedAt: now.Add(-2 * time.Hour)},
+		{Tag: "old-feature", ManifestDigest: "sha256:d", CompressedSize: 40, UpdatedAt: now.Add(-3 * time.Hour)},
+	}
+
+	policy := do.CleanupInput{Registry: "my-registry", Policy: cleanup.Policy{KeepTags: 5}}
+	tokens := []Token{
+		{Name: "admin", Token: "admin-token", Repositories: []string{"*"}},
+		{Name: "backend", Token: "backend-token", Repositories: []string{"backend"}},
+	}
+
+	return NewServer(registry, policy, tokens)
+}
+
+func call(t *testing.T, server *httptest.Server, method, path, token, body string, output any) int {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	assert.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	if output != nil {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(output))
+	}
+	return resp.StatusCode
+}
+
+func TestServer_Authentication(t *testing.T) {
+	server := newTestServer(&fakeRegistry{})
+	defer server.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, call(t, server, http.MethodGet, "/api/v1/repositories", "", "", nil))
+	assert.Equal(t, http.StatusUnauthorized, call(t, server, http.MethodGet, "/api/v1/repositories", "wrong", "", nil))
+	assert.Equal(t, http.StatusForbidden, call(t, server, http.MethodGet, "/api/v1/repositories/frontend/plan", "backend-token", "", nil))
+	assert.Equal(t, http.StatusForbidden, call(t, server, http.MethodPost, "/api/v1/repositories/frontend/cleanup", "backend-token", "", nil))
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodGet, "/api/v1/repositories/frontend/plan", "admin-token", "", nil))
+}
+
+func TestServer_ListRepositories(t *testing.T) {
+	server := newTestServer(&fakeRegistry{})
+	defer server.Close()
+
+	var repositories []do.Repository
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodGet, "/api/v1/repositories", "backend-token", "", &repositories))
+	assert.Len(t, repositories, 1)
+	assert.Equal(t, "backend", repositories[0].Name)
+
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodGet, "/api/v1/repositories", "admin-token", "", &repositories))
+	assert.Len(t, repositories, 2)
+}
+
+func TestServer_ListTags(t *testing.T) {
+	registry := &fakeRegistry{}
+	server := newTestServer(registry)
+	defer server.Close()
+
+	var tags []TagInfo
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodGet, "/api/v1/repositories/backend/tags", "backend-token", "", &tags))
+	assert.Len(t, tags, 4)
+
+	kinds := map[string]string{}
+	actions := map[string]string{}
+	for _, tag := range tags {
+		kinds[tag.Tag] = tag.Kind
+		actions[tag.Tag] = tag.Action
+	}
+	assert.Equal(t, map[string]string{"latest": "protected", "1.0.0": "release", "pr-12": "pull_request", "old-feature": "branch"}, kinds)
+	assert.Equal(t, "delete", actions["old-feature"])
+	assert.Equal(t, "keep", actions["latest"])
+	assert.Equal(t, string(cleanup.ReasonBranchAge), tags[3].Reason)
+	assert.Equal(t, "deleted", tags[3].Explanation)
+	assert.Equal(t, "backend", registry.inputs[0].Repository)
+	assert.Equal(t, "my-registry", registry.inputs[0].Registry)
+}
+
+func TestServer_Plan(t *testing.T) {
+	server := newTestServer(&fakeRegistry{})
+	defer server.Close()
+
+	var plan Plan
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodGet, "/api/v1/repositories/backend/plan", "backend-token", "", &plan))
+	assert.Equal(t, "backend", plan.Repository)
+	assert.Equal(t, []string{"old-feature"}, plan.Delete)
+	assert.Equal(t, int64(40), plan.FreedBytes)
+	assert.NotEmpty(t, plan.ID)
+}
+
+func TestServer_Cleanup(t *testing.T) {
+	registry := &fakeRegistry{}
+	server := newTestServer(registry)
+	defer server.Close()
+
+	var result CleanupResult
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodPost, "/api/v1/repositories/backend/cleanup", "backend-token", `{"dry_run": true}`, &result))
+	assert.True(t, result.DryRun)
+	assert.Equal(t, []string{"old-feature"}, result.Deleted)
+	assert.True(t, registry.dryRuns[0])
+
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodPost, "/api/v1/repositories/backend/cleanup", "backend-token", "", &result))
+	assert.False(t, result.DryRun)
+	assert.False(t, registry.dryRuns[1])
+
+	assert.Equal(t, http.StatusBadRequest, call(t, server, http.MethodPost, "/api/v1/repositories/backend/cleanup", "backend-token", "{", nil))
+}
+
+func TestServer_Error(t *testing.T) {
+	server := newTestServer(&fakeRegistry{err: errors.New("boom")})
+	defer server.Close()
+
+	var result map[string]string
+	assert.Equal(t, http.StatusBadGateway, call(t, server, http.MethodGet, "/api/v1/repositories/backend/plan", "backend-token", "", &result))
+	assert.Equal(t, "boom", result["error"])
+}
+
+func TestServer_CleanupGuard(t *testing.T) {
+	registry := &fakeRegistry{}
+	s := newServer(registry)
+	s.SetGuard(func(repository string) cleanup.Guard {
+		if repository == "backend" {
+			return cleanup.Guard{MinRemaining: 4}
+		}
+		return cleanup.Guard{}
+	})
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	var result CleanupResult
+	assert.Equal(t, http.StatusUnprocessableEntity, call(t, server, http.MethodPost, "/api/v1/repositories/backend/cleanup", "admin-token", "", &result))
+	assert.Contains(t, result.Error, "leaves fewer than 4 tags")
+	assert.Empty(t, result.Deleted)
+
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodPost, "/api/v1/repositories/frontend/cleanup", "admin-token", "", &result))
+	assert.Equal(t, []string{"old-feature"}, result.Deleted)
+}
+
+func TestServer_CleanupPlanID(t *testing.T) {
+	registry := &fakeRegistry{}
+	server := newTestServer(registry)
+	defer server.Close()
+
+	var plan Plan
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodGet, "/api/v1/repositories/backend/plan", "backend-token", "", &plan))
+
+	// a tag pushed again since the plan was fetched
+	registry.tags[3].ManifestDigest = "sha256:e"
+
+	var result CleanupResult
+	assert.Equal(t, http.StatusConflict, call(t, server, http.MethodPost, "/api/v1/repositories/backend/cleanup", "backend-token", `{"plan_id": "`+plan.ID+`"}`, &result))
+	assert.Contains(t, result.Error, "plan changed")
+	assert.Empty(t, registry.dryRuns)
+
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodGet, "/api/v1/repositories/backend/plan", "backend-token", "", &plan))
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodPost, "/api/v1/repositories/backend/cleanup", "backend-token", `{"plan_id": "`+plan.ID+`"}`, &result))
+	assert.Equal(t, []string{"old-feature"}, result.Deleted)
+}
+
+func TestServer_CleanupPreflight(t *testing.T) {
+	for name, tc := range map[string]struct {
+		problems []do.Problem
+		status   int
+	}{
+		"missing repository": {problems: []do.Problem{{Subject: "repository backend", Message: "repository not found in registry my-registry"}}, status: http.StatusNotFound},
+		"read-only token":    {problems: []do.Problem{{Subject: "token", Message: "token is read-only and cannot delete tags"}}, status: http.StatusForbidden},
+		"wrong registry":     {problems: []do.Problem{{Subject: "registry", Message: "registry my-registry not found"}}, status: http.StatusUnprocessableEntity},
+		"api failure": {
+			problems: []do.Problem{
+				{Subject: "repository backend", Message: "repository not found in registry my-registry"},
+				{Subject: "token", Message: "could not verify the delete scope", Err: &do.APIError{StatusCode: http.StatusInternalServerError}},
+			},
+			status: http.StatusBadGateway,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			registry := &fakeRegistry{problems: tc.problems}
+			server := newTestServer(registry)
+			defer server.Close()
+
+			var result CleanupResult
+			assert.Equal(t, tc.status, call(t, server, http.MethodPost, "/api/v1/repositories/backend/cleanup", "backend-token", "", &result))
+			assert.Contains(t, result.Error, "pre-flight check failed")
+			assert.Empty(t, registry.dryRuns)
+		})
+	}
+}
+
+func TestServer_UpstreamStatus(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err    error
+		status int
+	}{
+		"not found": {err: &do.APIError{StatusCode: http.StatusNotFound}, status: http.StatusNotFound},
+		"forbidden": {err: &do.APIError{StatusCode: http.StatusForbidden}, status: http.StatusForbidden},
+		"failure":   {err: &do.APIError{StatusCode: http.StatusServiceUnavailable}, status: http.StatusBadGateway},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := newTestServer(&fakeRegistry{err: fmt.Errorf("could not list tags: %w", tc.err)})
+			defer server.Close()
+
+			assert.Equal(t, tc.status, call(t, server, http.MethodGet, "/api/v1/repositories/backend/plan", "backend-token", "", nil))
+			assert.Equal(t, tc.status, call(t, server, http.MethodPost, "/api/v1/repositories/backend/cleanup", "backend-token", "", nil))
+		})
+	}
+}
+
+func TestServer_CleanupLockedAndAudited(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "dorc.lock")
+	auditPath := filepath.Join(dir, "audit.jsonl")
+	statePath := filepath.Join(dir, "quarantine.json")
+
+	registry := &fakeRegistry{}
+	s := newServer(registry)
+	s.SetRunConfig(runner.Config{Lock: lockPath, LockHolder: "api", AuditLog: auditPath, QuarantineState: statePath})
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	// a run of another host holds the lock
+	held, err := lock.Open(lockPath, lock.Config{Holder: "cronjob"})
+	assert.NoError(t, err)
+	assert.NoError(t, held.Acquire())
+
+	var result CleanupResult
+	assert.Equal(t, http.StatusConflict, call(t, server, http.MethodPost, "/api/v1/repositories/backend/cleanup", "backend-token", "", &result))
+	assert.Contains(t, result.Error, "run lock is held by cronjob")
+	assert.Empty(t, registry.dryRuns)
+	assert.NoError(t, held.Release())
+
+	registry.executing = func() {
+		content, err := os.ReadFile(lockPath)
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), `"holder":"api/`)
+	}
+	assert.Equal(t, http.StatusOK, call(t, server, http.MethodPost, "/api/v1/repositories/backend/cleanup", "backend-token", "", &result))
+	assert.Equal(t, []string{"old-feature"}, result.Deleted)
+	assert.NotEmpty(t, result.RunID)
+	assert.NoFileExists(t, lockPath)
+
+	content, err := os.ReadFile(auditPath)
+	assert.NoError(t, err)
+	var record audit.Record
+	assert.NoError(t, json.Unmarshal(content, &record))
+	assert.Equal(t, "old-feature", record.Tag)
+	assert.Equal(t, "backend", record.Repository)
+	assert.Equal(t, result.RunID, record.RunID)
+
+	state, err := quarantine.Load(statePath)
+	assert.NoError(t, err)
+	assert.Len(t, state.Entries, 1)
+	assert.Equal(t, "sha256:d", state.Entries[0].Digest)
+}
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/s3"
+)
+
+// Record describes a single deletion.
+type Record struct {
+	Time       time.Time `json:"timestamp"`
+	RunID      string    `json:"run_id"`
+	Registry   string    `json:"registry"`
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag"`
+	Digest     string    `json:"digest"`
+	SizeBytes  int       `json:"size_bytes"`
+	Reason     string    `json:"reason"`
+	DryRun     bool      `json:"dry_run"`
+}
+
+// Sink stores audit records as JSON Lines.
+type Sink interface {
+	Write(records []Record) error
+	Close() error
+}
+
+// NewRunID returns a unique, time-ordered identifier of a cleanup run.
+func NewRunID(now time.Time) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// Open returns the sink for the target:
+//   - "-" or "stdout" writes to the standard output
+//   - "s3://bucket/prefix" uploads one object per run to an S3-compatible bucket
+//   - anything else is a path of a local file the records are appended to
+func Open(target, runID string, s3Config s3.Config) (Sink, error) {
+	switch {
+	case target == "-" || target == "stdout":
+		return &writerSink{w: os.Stdout}, nil
+	case strings.HasPrefix(target, "s3://"):
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(target, "s3://"), "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid audit log target %q: bucket is missing", target)
+		}
+
+		client, err := s3.New(s3Config)
+		if err != nil {
+			return nil, fmt.Errorf("could not create S3 client: %w", err)
+		}
+
+		return &s3Sink{
+			client: client,
+			bucket: bucket,
+			key:    path.Join(prefix, runID+".jsonl"),
+		}, nil
+	default:
+		file, err := os.OpenFile(strings.TrimPrefix(target, "file://"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("could not open audit log: %w", err)
+		}
+		return &writerSink{w: file, closer: file}, nil
+	}
+}
+
+func encode(records []Record) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return nil, fmt.Errorf("could not encode audit record: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writerSink appends records to a file or the standard output.
+type writerSink struct {
+	w      io.Writer
+	closer io.Closer
+}
+
+func (s *writerSink) Write(records []Record) error {
+	data, err := encode(records)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.w.Write(data); err != nil {
+		return fmt.Errorf("could not write audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (s *writerSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// s3Sink uploads all records of the run as a single object.
+// S3 has no append, so the object is rewritten with every write to keep it up to date.
+type s3Sink struct {
+	client *s3.Client
+	bucket string
+	key    string
+	data   []byte
+}
+
+func (s *s3Sink) Write(records []Record) error {
+	data, err := encode(records)
+	if err != nil {
+		return err
+	}
+
+	s.data = append(s.data, data...)
+	if err := s.client.PutObject(s.bucket, s.key, s.data, "application/x-ndjson"); err != nil {
+		return fmt.Errorf("could not upload audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (s *s3Sink) Close() error {
+	return nil
+}
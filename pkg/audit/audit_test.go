@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/s3"
+	"digitalocean-registry-cleaner/pkg/s3/s3test"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRecord(tag string) Record {
+	return Record{
+		Time:       time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC),
+		RunID:      "20261018T020000Z-00000000",
+		Registry:   "my-registry",
+		Repository: "backend",
+		Tag:        tag,
+		Digest:     "sha256:" + tag,
+		SizeBytes:  1024,
+		Reason:     "branch tag older than the maximum age",
+	}
+}
+
+func decode(t *testing.T, data []byte) []Record {
+	var records []Record
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record Record
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestFileSink_Appends(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	for _, tag := range []string{"a", "b"} {
+		sink, err := Open(target, "run", s3.Config{})
+		assert.NoError(t, err)
+		assert.NoError(t, sink.Write([]Record{testRecord(tag)}))
+		assert.NoError(t, sink.Close())
+	}
+
+	data, err := os.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{testRecord("a"), testRecord("b")}, decode(t, data))
+}
+
+func TestS3Sink_UploadsRunObject(t *testing.T) {
+	server, storage := s3test.NewServer(t)
+
+	sink, err := Open("s3://audit/dorc", "run-1", s3.Config{Endpoint: server.URL, AccessKey: s3test.AccessKey, SecretKey: s3test.SecretKey})
+	assert.NoError(t, err)
+
+	assert.NoError(t, sink.Write([]Record{testRecord("a")}))
+	assert.NoError(t, sink.Write([]Record{testRecord("b")}))
+	assert.NoError(t, sink.Close())
+
+	// the object contains all records of the run
+	assert.Equal(t, []Record{testRecord("a"), testRecord("b")}, decode(t, storage.Object("/audit/dorc/run-1.jsonl")))
+}
+
+func TestOpen_InvalidS3Target(t *testing.T) {
+	_, err := Open("s3://", "run", s3.Config{Endpoint: "https://fra1.digitaloceanspaces.com"})
+	assert.Error(t, err)
+}
+
+func TestNewRunID(t *testing.T) {
+	now := time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+
+	a, b := NewRunID(now), NewRunID(now)
+
+	assert.True(t, strings.HasPrefix(a, "20261018T020000Z-"))
+	assert.NotEqual(t, a, b)
+}
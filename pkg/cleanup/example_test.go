@@ -0,0 +1,64 @@
+package cleanup_test
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/do"
+)
+
+func ExamplePlan() {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	tags := []cleanup.Tag{
+		{Tag: "latest", ManifestDigest: "sha256:a", UpdatedAt: now.AddDate(0, 0, -1)},
+		{Tag: "1.0.0", ManifestDigest: "sha256:b", UpdatedAt: now.AddDate(0, 0, -90)},
+		{Tag: "1.1.0", ManifestDigest: "sha256:a", UpdatedAt: now.AddDate(0, 0, -1)},
+		{Tag: "feature-login", ManifestDigest: "sha256:c", UpdatedAt: now.AddDate(0, 0, -45)},
+	}
+
+	decisions := cleanup.Plan(tags, cleanup.Policy{
+		Protected: []string{"latest"},
+		KeepTags:  1,
+		MinAge:    30 * 24 * time.Hour,
+	}, now)
+
+	for _, tag := range tags {
+		decision, _ := decisions.Explain(tag.Tag)
+		fmt.Printf("%s: %s\n", tag.Tag, decision.Explanation)
+	}
+	// Output:
+	// latest: protected by rule "latest"
+	// 1.0.0: deleted as release #2, only the newest 1 releases are kept
+	// 1.1.0: kept as one of the newest 1 releases (#1)
+	// feature-login: deleted as branch older than 30 days
+}
+
+func ExampleExecutor() {
+	client := do.NewClient(os.Getenv("DO_TOKEN"), nil)
+
+	tags, err := client.ListTags("my-registry", "backend")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	decisions := cleanup.Plan(tags, cleanup.Policy{
+		Protected: []string{"latest", "main"},
+		KeepTags:  10,
+		MinAge:    30 * 24 * time.Hour,
+		Guard:     cleanup.Guard{MaxDeletePercent: 50},
+	}, time.Now())
+	decisions.Registry = "my-registry"
+	decisions.Repository = "backend"
+
+	executor := &cleanup.Executor{Deleter: client}
+	deleted, err := executor.Execute(decisions, true) // dry run
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("would delete %d tags\n", len(deleted))
+}
@@ -0,0 +1,68 @@
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrNotFound is wrapped by Deleter errors of tags which do not exist (anymore).
+var ErrNotFound = errors.New("tag not found")
+
+// Deleter deletes tags from a registry, e.g. the DigitalOcean registry client.
+type Deleter interface {
+	// DeleteTag deletes the tag, the error wraps ErrNotFound if the tag does not exist.
+	DeleteTag(registry, repository, tag string) error
+}
+
+// Executor deletes the planned tags.
+type Executor struct {
+	Deleter Deleter
+	// Logger logs every deletion, slog.Default() if nil.
+	Logger *slog.Logger
+}
+
+// Execute deletes the planned tags, nothing is deleted if the decisions exceed their Guard.
+// Tags which no longer exist are not an error, they are recorded in d.Gone instead.
+// Returns a list of deleted tags, in dry-run mode the tags which would be deleted.
+func (e *Executor) Execute(d *Decisions, dryRun bool) ([]Tag, error) {
+	logger := e.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	if err := d.Check(); err != nil {
+		return nil, err
+	}
+
+	var deletedTags []Tag
+	d.Gone = nil
+	for _, tag := range d.Delete {
+		if !dryRun {
+			err := e.Deleter.DeleteTag(d.Registry, d.Repository, tag.Tag)
+			if errors.Is(err, ErrNotFound) {
+				logger.Info("tag already gone",
+					"registry", d.Registry,
+					"repository", d.Repository,
+					"tag", tag.Tag,
+				)
+				d.Gone = append(d.Gone, tag)
+				continue
+			}
+			if err != nil {
+				return deletedTags, fmt.Errorf("could not delete tag %s.%s:%s : %w", d.Registry, d.Repository, tag.Tag, err)
+			}
+		}
+		logger.Info("deleted tag",
+			"registry", d.Registry,
+			"repository", d.Repository,
+			"tag", tag.Tag,
+			"digest", tag.ManifestDigest,
+			"reason", string(d.Reasons[tag.Tag]),
+			"dry_run", dryRun,
+		)
+		deletedTags = append(deletedTags, tag)
+	}
+
+	return deletedTags, nil
+}
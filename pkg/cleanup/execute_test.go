@@ -0,0 +1,100 @@
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDeleter deletes tags from an in-memory repository
+type fakeDeleter struct {
+	tags    []string
+	deleted []string
+	err     error
+}
+
+func (f *fakeDeleter) DeleteTag(registry, repository, tag string) error {
+	if f.err != nil {
+		return f.err
+	}
+	if !slices.Contains(f.tags, tag) {
+		return fmt.Errorf("%w: %s", ErrNotFound, tag)
+	}
+	f.tags = slices.DeleteFunc(f.tags, func(name string) bool { return name == tag })
+	f.deleted = append(f.deleted, tag)
+	return nil
+}
+
+func newExecutor(deleter Deleter) *Executor {
+	return &Executor{Deleter: deleter, Logger: slog.New(slog.DiscardHandler)}
+}
+
+func executorPlan() *Decisions {
+	plan := Plan([]Tag{
+		fakeTag("old-1", 72*time.Hour),
+		fakeTag("old-2", 48*time.Hour),
+		fakeTag("new", time.Hour),
+	}, Policy{MinAge: 24 * time.Hour}, now)
+	plan.Registry = "test"
+	plan.Repository = "test"
+	return plan
+}
+
+func TestExecutor(t *testing.T) {
+	deleter := &fakeDeleter{tags: []string{"old-1", "old-2", "new"}}
+	plan := executorPlan()
+
+	deleted, err := newExecutor(deleter).Execute(plan, false)
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"old-1", "old-2"}, TagNames(deleted))
+	assert.ElementsMatch(t, []string{"old-1", "old-2"}, deleter.deleted)
+	assert.Empty(t, plan.Gone)
+}
+
+func TestExecutor_DryRun(t *testing.T) {
+	deleter := &fakeDeleter{tags: []string{"old-1", "old-2", "new"}}
+
+	deleted, err := newExecutor(deleter).Execute(executorPlan(), true)
+
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 2)
+	assert.Empty(t, deleter.deleted)
+}
+
+func TestExecutor_AlreadyGone(t *testing.T) {
+	deleter := &fakeDeleter{tags: []string{"old-2", "new"}}
+	plan := executorPlan()
+
+	deleted, err := newExecutor(deleter).Execute(plan, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old-2"}, TagNames(deleted))
+	assert.Equal(t, []string{"old-1"}, TagNames(plan.Gone))
+}
+
+func TestExecutor_Error(t *testing.T) {
+	deleter := &fakeDeleter{err: errors.New("connection refused")}
+
+	deleted, err := newExecutor(deleter).Execute(executorPlan(), false)
+
+	assert.ErrorContains(t, err, "could not delete tag test.test:")
+	assert.Empty(t, deleted)
+}
+
+func TestExecutor_Guard(t *testing.T) {
+	deleter := &fakeDeleter{tags: []string{"old-1", "old-2", "new"}}
+	plan := executorPlan()
+	plan.Guard = Guard{MaxDelete: 1}
+
+	deleted, err := newExecutor(deleter).Execute(plan, false)
+
+	assert.ErrorIs(t, err, ErrSafetyLimit)
+	assert.Empty(t, deleted)
+	assert.Empty(t, deleter.deleted)
+}
@@ -0,0 +1,71 @@
+package cleanup
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Kinds of tags distinguished by the planner.
+const (
+	KindProtected   = "protected"
+	KindPinned      = "pinned"
+	KindLabeled     = "labeled"
+	KindRelease     = "release"
+	KindBranch      = "branch"
+	KindPullRequest = "pull_request"
+)
+
+// Decision records why the planner keeps or deletes a tag.
+type Decision struct {
+	Tag         string `json:"tag"`
+	Kind        string `json:"kind"`
+	Delete      bool   `json:"delete"`
+	Explanation string `json:"explanation"`
+}
+
+// Explain returns the decision about the tag, false if the repository has no such tag.
+func (p *Decisions) Explain(tag string) (Decision, bool) {
+	decision, ok := p.ByTag[tag]
+	return decision, ok
+}
+
+// decide records the decision about the tag.
+func (p *Decisions) decide(tag Tag, kind string, deleted bool, format string, args ...any) {
+	if p.ByTag == nil {
+		p.ByTag = map[string]Decision{}
+	}
+	p.ByTag[tag.Tag] = Decision{
+		Tag:         tag.Tag,
+		Kind:        kind,
+		Delete:      deleted,
+		Explanation: fmt.Sprintf(format, args...),
+	}
+}
+
+// days rounds the duration up to whole days.
+func days(d time.Duration) int {
+	return int(math.Ceil(d.Hours() / 24))
+}
+
+// tooYoung explains how long a tag is kept before it reaches the maximum age.
+func tooYoung(tag Tag, maxAge time.Duration, now time.Time) string {
+	return fmt.Sprintf("too young by %d days (deleted after %d days)", days(maxAge-now.Sub(tag.UpdatedAt)), days(maxAge))
+}
+
+// pinned explains the pin keeping a tag.
+func pinned(pin Pin) string {
+	explanation := fmt.Sprintf("pinned until %s", pin.Until.Format(time.DateOnly))
+	if pin.Reason != "" {
+		explanation += ": " + pin.Reason
+	}
+	return explanation
+}
+
+// eligibleSuffix notes that the tag may still be deleted to reach a storage target.
+func eligibleSuffix(eligible bool) string {
+	if eligible {
+		return ", eligible for a storage target"
+	}
+	return ""
+}
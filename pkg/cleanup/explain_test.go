@@ -0,0 +1,83 @@
+package cleanup
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan_Decisions(t *testing.T) {
+	day := 24 * time.Hour
+	plan := Plan([]Tag{
+		fakeTag("latest", 100*day),
+		fakeTag("1.0.0", 50*day),
+		fakeTag("1.1.0", 40*day),
+		fakeTag("1.2.0", 30*day),
+		fakeTag("feature-old", 45*day),
+		fakeTag("feature-new", 10*day),
+		fakeTag("pr-1", 5*day),
+		fakeTag("pr-2", 5*day),
+	}, Policy{
+		Protected: []string{"latest"},
+		KeepTags:  2,
+		MinAge:    30 * day,
+		PRPattern: regexp.MustCompile(`^pr-(\d+)$`),
+		PRMaxAge:  7 * day,
+		OpenPRs:   []int{1},
+	}, now)
+	assert.Len(t, plan.ByTag, 8)
+
+	expected := map[string]Decision{
+		"latest":      {Kind: KindProtected, Delete: false, Explanation: `protected by rule "latest"`},
+		"1.0.0":       {Kind: KindRelease, Delete: true, Explanation: "deleted as release #3, only the newest 2 releases are kept"},
+		"1.1.0":       {Kind: KindRelease, Delete: false, Explanation: "kept as one of the newest 2 releases (#2)"},
+		"1.2.0":       {Kind: KindRelease, Delete: false, Explanation: "kept as one of the newest 2 releases (#1)"},
+		"feature-old": {Kind: KindBranch, Delete: true, Explanation: "deleted as branch older than 30 days"},
+		"feature-new": {Kind: KindBranch, Delete: false, Explanation: "kept as branch, too young by 20 days (deleted after 30 days)"},
+		"pr-1":        {Kind: KindPullRequest, Delete: false, Explanation: "kept as pull request #1, too young by 2 days (deleted after 7 days)"},
+		"pr-2":        {Kind: KindPullRequest, Delete: true, Explanation: "deleted as pull request #2 which is closed"},
+	}
+
+	for tag, want := range expected {
+		decision, ok := plan.Explain(tag)
+		assert.True(t, ok, tag)
+		want.Tag = tag
+		assert.Equal(t, want, decision, tag)
+	}
+
+	_, ok := plan.Explain("missing")
+	assert.False(t, ok)
+}
+
+func TestPlan_DecisionsKeepBranches(t *testing.T) {
+	day := 24 * time.Hour
+	plan := Plan([]Tag{
+		fakeTag("feature-1", 1*day),
+		fakeTag("feature-2", 2*day),
+		fakeTag("feature-3", 3*day),
+	}, Policy{KeepTags: 1, MinAge: 30 * day, KeepBranches: 2}, now)
+
+	decision, _ := plan.Explain("feature-2")
+	assert.Equal(t, "kept as one of the newest 2 branches (#2), too young by 28 days (deleted after 30 days)", decision.Explanation)
+
+	decision, _ = plan.Explain("feature-3")
+	assert.True(t, decision.Delete)
+	assert.Equal(t, "deleted as branch #3, only the newest 2 branches are kept", decision.Explanation)
+}
+
+func TestSelectForTarget_Decisions(t *testing.T) {
+	day := 24 * time.Hour
+	plan := Plan([]Tag{fakeTag("feature", 40*day), fakeTag("1.0.0", day)}, Policy{KeepTags: 1, MinAge: 30 * day, MaxBranchAge: 60 * day}, now)
+
+	decision, _ := plan.Explain("feature")
+	assert.Equal(t, "kept as branch, too young by 20 days (deleted after 60 days), eligible for a storage target", decision.Explanation)
+
+	SelectForTarget([]*Decisions{plan}, 1000000, 0)
+
+	decision, _ = plan.Explain("feature")
+	assert.True(t, decision.Delete)
+	assert.Equal(t, KindBranch, decision.Kind)
+	assert.Equal(t, "deleted as one of the oldest eligible tags to reach the storage target", decision.Explanation)
+}
@@ -0,0 +1,73 @@
+package cleanup
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Upcoming is a tag kept now which the policy deletes within the forecast window.
+type Upcoming struct {
+	Tag Tag
+	// At is the time the tag crosses the age threshold, it is deleted by the first run after it.
+	At     time.Time
+	Reason Reason
+}
+
+// Forecast returns the tags kept by the policy at the time now which it deletes until the time until,
+// sorted by the time they cross the age threshold. It assumes no tags are pushed or deleted meanwhile.
+func Forecast(tags []Tag, policy Policy, now, until time.Time) []Upcoming {
+	deleted := map[string]bool{}
+	for _, tag := range Plan(tags, policy, now).Delete {
+		deleted[tag.Tag] = true
+	}
+
+	// deletions only change when a tag crosses one of the age thresholds or its pin or label expires
+	var times []time.Time
+	for _, pin := range policy.Pins {
+		if pin.Until.After(now) && !pin.Until.After(until) {
+			times = append(times, pin.Until)
+		}
+	}
+	for _, labels := range policy.Labels {
+		if expires, ok := labelExpiry(labels); ok && expires.After(now) && !expires.After(until) {
+			times = append(times, expires)
+		}
+	}
+	for _, tag := range tags {
+		if deleted[tag.Tag] {
+			continue
+		}
+		for _, age := range []time.Duration{policy.MinAge, policy.MaxBranchAge, policy.PRMaxAge} {
+			at := tag.UpdatedAt.Add(age)
+			if age > 0 && at.After(now) && !at.After(until) {
+				times = append(times, at)
+			}
+		}
+	}
+	slices.SortFunc(times, func(a, b time.Time) int {
+		return a.Compare(b)
+	})
+	times = slices.CompactFunc(times, time.Time.Equal)
+
+	var upcoming []Upcoming
+	for _, at := range times {
+		plan := Plan(tags, policy, at)
+		for _, tag := range plan.Delete {
+			if deleted[tag.Tag] {
+				continue
+			}
+			deleted[tag.Tag] = true
+			upcoming = append(upcoming, Upcoming{Tag: tag, At: at, Reason: plan.Reasons[tag.Tag]})
+		}
+	}
+
+	slices.SortStableFunc(upcoming, func(a, b Upcoming) int {
+		if c := a.At.Compare(b.At); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Tag.Tag, b.Tag.Tag)
+	})
+
+	return upcoming
+}
@@ -0,0 +1,76 @@
+package cleanup
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForecast(t *testing.T) {
+	day := 24 * time.Hour
+	tags := []Tag{
+		fakeTag("main", 90*day),
+		fakeTag("1.0.0", 60*day),
+		fakeTag("1.1.0", 50*day),
+		fakeTag("feature-old", 45*day),
+		fakeTag("feature-soon", 25*day),
+		fakeTag("feature-later", 20*day),
+		fakeTag("feature-new", 2*day),
+		fakeTag("pr-1", 10*day),
+		fakeTag("pr-2", 3*day),
+	}
+
+	policy := Policy{
+		Protected: []string{"main"},
+		KeepTags:  1,
+		MinAge:    30 * day,
+		PRPattern: regexp.MustCompile(`^pr-(\d+)$`),
+		PRMaxAge:  14 * day,
+	}
+
+	upcoming := Forecast(tags, policy, now, now.Add(14*day))
+
+	var names []string
+	for _, u := range upcoming {
+		names = append(names, u.Tag.Tag)
+	}
+	assert.Equal(t, []string{"pr-1", "feature-soon", "feature-later", "pr-2"}, names)
+
+	assert.Equal(t, now.Add(4*day), upcoming[0].At)
+	assert.Equal(t, ReasonPRAge, upcoming[0].Reason)
+	assert.Equal(t, now.Add(5*day), upcoming[1].At)
+	assert.Equal(t, ReasonBranchAge, upcoming[1].Reason)
+	assert.Equal(t, now.Add(10*day), upcoming[2].At)
+	assert.Equal(t, now.Add(11*day), upcoming[3].At)
+
+	// every forecast tag is deleted by a plan at its time and kept just before
+	for _, u := range upcoming {
+		assert.Contains(t, TagNames(Plan(tags, policy, u.At).Delete), u.Tag.Tag)
+		assert.NotContains(t, TagNames(Plan(tags, policy, u.At.Add(-time.Second)).Delete), u.Tag.Tag)
+	}
+}
+
+func TestForecast_Empty(t *testing.T) {
+	day := 24 * time.Hour
+	tags := []Tag{
+		fakeTag("main", 90*day),
+		fakeTag("feature-old", 45*day),
+	}
+
+	assert.Empty(t, Forecast(tags, Policy{Protected: []string{"main"}, KeepTags: 1, MinAge: 30 * day}, now, now.Add(14*day)))
+	assert.Empty(t, Forecast(nil, Policy{KeepTags: 1, MinAge: 30 * day}, now, now.Add(14*day)))
+}
+
+func TestForecast_PinExpires(t *testing.T) {
+	day := 24 * time.Hour
+	tags := []Tag{fakeTag("feature-incident", 60*day), fakeTag("main", day)}
+	policy := Policy{KeepTags: 1, MinAge: 30 * day, Pins: []Pin{{Tag: "feature-incident", Until: now.Add(3 * day)}}}
+
+	upcoming := Forecast(tags, policy, now, now.Add(14*day))
+	assert.Len(t, upcoming, 1)
+	assert.Equal(t, "feature-incident", upcoming[0].Tag.Tag)
+	assert.Equal(t, now.Add(3*day), upcoming[0].At)
+	assert.Equal(t, ReasonBranchAge, upcoming[0].Reason)
+}
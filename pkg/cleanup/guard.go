@@ -0,0 +1,66 @@
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSafetyLimit is wrapped by errors of plans exceeding their Guard.
+var ErrSafetyLimit = errors.New("safety limit exceeded")
+
+// Guard limits the deletions of a single repository; zero values disable the limits.
+type Guard struct {
+	// MaxDeletePercent is the maximum share of the tags deleted by a run.
+	MaxDeletePercent float64
+	// MaxDelete is the maximum number of tags deleted by a run.
+	MaxDelete int
+	// MinRemaining is the minimum number of tags left in the repository, protected tags included.
+	MinRemaining int
+}
+
+// GuardError describes a plan exceeding its Guard.
+type GuardError struct {
+	Registry   string
+	Repository string
+	Delete     int
+	Total      int
+	Limit      string
+}
+
+func (e *GuardError) Error() string {
+	return fmt.Sprintf("refusing to delete %d of %d tags of %s/%s: %s", e.Delete, e.Total, e.Registry, e.Repository, e.Limit)
+}
+
+func (e *GuardError) Unwrap() error {
+	return ErrSafetyLimit
+}
+
+// Check returns a GuardError if the plan exceeds the guard, nil if the plan is forced.
+func (p *Decisions) Check() error {
+	if p.Force || len(p.Delete) == 0 {
+		return nil
+	}
+
+	total := len(p.Tags)
+	count := len(p.Delete)
+
+	var limit string
+	switch {
+	case p.Guard.MaxDelete > 0 && count > p.Guard.MaxDelete:
+		limit = fmt.Sprintf("exceeds the limit of %d tags", p.Guard.MaxDelete)
+	case p.Guard.MaxDeletePercent > 0 && float64(count)*100/float64(total) > p.Guard.MaxDeletePercent:
+		limit = fmt.Sprintf("exceeds the limit of %g%% of the tags", p.Guard.MaxDeletePercent)
+	case p.Guard.MinRemaining > 0 && total-count < p.Guard.MinRemaining:
+		limit = fmt.Sprintf("leaves fewer than %d tags", p.Guard.MinRemaining)
+	default:
+		return nil
+	}
+
+	return &GuardError{
+		Registry:   p.Registry,
+		Repository: p.Repository,
+		Delete:     count,
+		Total:      total,
+		Limit:      limit,
+	}
+}
@@ -0,0 +1,64 @@
+package cleanup
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func guardPlan(total, deleted int, guard Guard) *Decisions {
+	plan := &Decisions{Registry: "test", Repository: "test", Guard: guard}
+	for i := range total {
+		tag := fakeTag(fmt.Sprintf("tag-%d", i), time.Hour)
+		plan.Tags = append(plan.Tags, tag)
+		if i < deleted {
+			plan.Delete = append(plan.Delete, tag)
+		}
+	}
+	return plan
+}
+
+func TestDecisions_Check(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		deleted int
+		guard   Guard
+		limit   string
+	}{
+		{name: "disabled", total: 10, deleted: 10},
+		{name: "nothing deleted", total: 10, deleted: 0, guard: Guard{MinRemaining: 20}},
+		{name: "max delete", total: 10, deleted: 4, guard: Guard{MaxDelete: 3}, limit: "exceeds the limit of 3 tags"},
+		{name: "max delete reached", total: 10, deleted: 3, guard: Guard{MaxDelete: 3}},
+		{name: "max percent", total: 10, deleted: 6, guard: Guard{MaxDeletePercent: 50}, limit: "exceeds the limit of 50% of the tags"},
+		{name: "max percent reached", total: 10, deleted: 5, guard: Guard{MaxDeletePercent: 50}},
+		{name: "min remaining", total: 10, deleted: 8, guard: Guard{MinRemaining: 3}, limit: "leaves fewer than 3 tags"},
+		{name: "min remaining reached", total: 10, deleted: 7, guard: Guard{MinRemaining: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := guardPlan(tt.total, tt.deleted, tt.guard).Check()
+			if tt.limit == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var guardErr *GuardError
+			assert.ErrorAs(t, err, &guardErr)
+			assert.ErrorIs(t, err, ErrSafetyLimit)
+			assert.Equal(t, tt.limit, guardErr.Limit)
+			assert.Equal(t, tt.deleted, guardErr.Delete)
+			assert.Equal(t, tt.total, guardErr.Total)
+		})
+	}
+}
+
+func TestDecisions_CheckForce(t *testing.T) {
+	plan := guardPlan(10, 10, Guard{MaxDelete: 1})
+	plan.Force = true
+
+	assert.NoError(t, plan.Check())
+}
@@ -0,0 +1,52 @@
+package cleanup
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Image labels controlling the retention of an image from its Dockerfile.
+const (
+	// LabelKeep set to true keeps the image forever.
+	LabelKeep = "dorc.keep"
+	// LabelExpires keeps the image until the date (midnight UTC) or RFC 3339 time, the policy applies afterwards.
+	LabelExpires = "dorc.expires"
+)
+
+// keptByLabel explains why the image labels keep a tag at the time now.
+func keptByLabel(labels map[string]string, now time.Time) (string, bool) {
+	if keep, err := strconv.ParseBool(labels[LabelKeep]); err == nil && keep {
+		return fmt.Sprintf("kept by label %s=%s", LabelKeep, labels[LabelKeep]), true
+	}
+
+	if expires, ok := labelExpiry(labels); ok && expires.After(now) {
+		return fmt.Sprintf("kept by label %s=%s until it expires", LabelExpires, labels[LabelExpires]), true
+	}
+
+	return "", false
+}
+
+// labelExpiry returns the time of the expiry label, false if it is missing or invalid.
+func labelExpiry(labels map[string]string) (time.Time, bool) {
+	value, ok := labels[LabelExpires]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+// HasRetentionLabels reports whether the labels contain any label controlling the retention.
+func HasRetentionLabels(labels map[string]string) bool {
+	_, keep := labels[LabelKeep]
+	_, expires := labels[LabelExpires]
+	return keep || expires
+}
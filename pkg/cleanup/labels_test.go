@@ -0,0 +1,57 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan_Labels(t *testing.T) {
+	day := 24 * time.Hour
+	tags := []Tag{
+		fakeTag("feature-keep", 60*day),
+		fakeTag("feature-expires", 60*day),
+		fakeTag("feature-expired", 60*day),
+		fakeTag("feature-invalid", 60*day),
+		fakeTag("feature-no", 60*day),
+		fakeTag("main", day),
+	}
+
+	plan := Plan(tags, Policy{
+		KeepTags: 1,
+		MinAge:   30 * day,
+		Labels: map[string]map[string]string{
+			"sha256:feature-keep":    {LabelKeep: "true"},
+			"sha256:feature-expires": {LabelExpires: "2026-12-31"},
+			"sha256:feature-expired": {LabelExpires: "2026-10-01T00:00:00Z"},
+			"sha256:feature-invalid": {LabelExpires: "next year", LabelKeep: "maybe"},
+			"sha256:feature-no":      {LabelKeep: "false", "org.opencontainers.image.source": "https://github.com/acme/backend"},
+		},
+	}, now)
+
+	assert.ElementsMatch(t, []string{"feature-keep", "feature-expires"}, TagNames(plan.Labeled))
+	assert.ElementsMatch(t, []string{"feature-expired", "feature-invalid", "feature-no"}, TagNames(plan.Delete))
+	assert.Equal(t, Decision{Tag: "feature-keep", Kind: KindLabeled, Explanation: "kept by label dorc.keep=true"}, plan.ByTag["feature-keep"])
+	assert.Equal(t, "kept by label dorc.expires=2026-12-31 until it expires", plan.ByTag["feature-expires"].Explanation)
+	assert.ElementsMatch(t, []string{"feature-expired", "feature-invalid", "feature-no"}, TagNames(plan.Candidates()))
+}
+
+func TestForecast_LabelExpires(t *testing.T) {
+	day := 24 * time.Hour
+	tags := []Tag{fakeTag("feature-x", 60*day), fakeTag("main", day)}
+	policy := Policy{KeepTags: 1, MinAge: 30 * day, Labels: map[string]map[string]string{
+		"sha256:feature-x": {LabelExpires: "2026-10-25"},
+	}}
+
+	upcoming := Forecast(tags, policy, now, now.Add(14*day))
+	assert.Len(t, upcoming, 1)
+	assert.Equal(t, time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC), upcoming[0].At)
+}
+
+func TestHasRetentionLabels(t *testing.T) {
+	assert.True(t, HasRetentionLabels(map[string]string{LabelKeep: "true"}))
+	assert.True(t, HasRetentionLabels(map[string]string{LabelExpires: "2026-12-31"}))
+	assert.False(t, HasRetentionLabels(map[string]string{"maintainer": "platform"}))
+	assert.False(t, HasRetentionLabels(nil))
+}
@@ -0,0 +1,272 @@
+// Package cleanup decides which tags of a repository are deleted by a retention policy and deletes them.
+//
+// Plan is a pure function of the tags, the policy and the current time, it does not talk to any registry.
+// Executor deletes the planned tags through a Deleter such as the DigitalOcean registry client.
+package cleanup
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/detect"
+)
+
+// Tag is a tag of a repository in the format of the DigitalOcean API.
+type Tag struct {
+	Tag            string    `json:"tag"`
+	ManifestDigest string    `json:"manifest_digest"`
+	CompressedSize int       `json:"compressed_size_bytes"`
+	Size           int       `json:"size_bytes"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TagNames returns the names of the tags, an empty slice if there are none.
+func TagNames(tags []Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Tag)
+	}
+	return names
+}
+
+// Policy is the retention policy of a repository.
+type Policy struct {
+	// Protected are tag names which are never deleted, compared case-insensitively.
+	Protected []string
+	// KeepTags is the number of the newest release tags to keep; zero keeps all releases.
+	KeepTags int
+	// MinAge is the age after which tags may be deleted.
+	MinAge time.Duration
+
+	// KeepBranches is the number of the newest branch tags to keep; zero keeps all branches within MaxBranchAge.
+	KeepBranches int
+	// MaxBranchAge is the age after which branch tags are deleted; zero falls back to MinAge.
+	MaxBranchAge time.Duration
+
+	// PRPattern matches pull request tags (e.g. pr-123); nil disables the pull request policy.
+	// The first capture group must contain the pull request number.
+	PRPattern *regexp.Regexp
+	// PRMaxAge is the age after which pull request tags are deleted; zero falls back to MinAge.
+	PRMaxAge time.Duration
+	// OpenPRs lists pull requests that are still open. Tags of pull requests missing from the list
+	// are deleted immediately. A nil slice means the list is unknown and only PRMaxAge applies.
+	OpenPRs []int
+
+	// Pins keep tags until their expiry, e.g. for an incident investigation.
+	Pins []Pin
+	// Labels are image labels by manifest digest, LabelKeep and LabelExpires keep tags of the image.
+	// Only the images of tags the policy deletes otherwise need to be known, see Decisions.Candidates.
+	Labels map[string]map[string]string
+
+	// Guard refuses plans deleting too many tags unless Force is set.
+	Guard Guard
+	Force bool
+}
+
+// Pin keeps a tag until the time whatever the retention policy decides.
+type Pin struct {
+	Tag    string
+	Until  time.Time
+	Reason string
+}
+
+// Reason explains why a tag is deleted.
+type Reason string
+
+const (
+	ReasonReleaseLimit Reason = "release tag over the keep-tags limit"
+	ReasonBranchLimit  Reason = "branch tag over the keep-branches limit"
+	ReasonBranchAge    Reason = "branch tag older than the maximum age"
+	ReasonPRClosed     Reason = "pull request is closed"
+	ReasonPRAge        Reason = "pull request tag older than the maximum age"
+	ReasonUsageTarget  Reason = "storage usage above the target"
+)
+
+// Decisions describe which tags of a repository are deleted by the retention policy.
+type Decisions struct {
+	// Registry and Repository identify the repository, they are set by the caller of Plan.
+	Registry   string
+	Repository string
+	// Tags are all tags of the repository.
+	Tags []Tag
+	// Protected are tags matching the protected names.
+	Protected []Tag
+	// Pinned are tags kept by a pin which has not expired yet.
+	Pinned []Tag
+	// Labeled are tags kept by the labels of their image.
+	Labeled []Tag
+	// Delete are tags deleted by the retention policy.
+	Delete []Tag
+	// Reasons explain the deletions by tag name.
+	Reasons map[string]Reason
+	// ByTag records why each tag is kept or deleted by tag name.
+	ByTag map[string]Decision
+	// Guard and Force of the policy, see Check.
+	Guard Guard
+	Force bool
+	// Eligible are tags kept by the retention policy which may still be deleted to reach a storage target.
+	// They are not protected, older than MinAge and outside the KeepTags/KeepBranches limits. Sorted from the oldest.
+	Eligible []Tag
+	// Gone are planned tags which were already deleted when the Executor reached them, e.g. by an overlapping run.
+	Gone []Tag
+}
+
+// Plan decides which of the tags are deleted by the policy at the time now.
+func Plan(tags []Tag, policy Policy, now time.Time) *Decisions {
+	prMaxAge := policy.PRMaxAge
+	if prMaxAge == 0 {
+		prMaxAge = policy.MinAge
+	}
+
+	maxBranchAge := policy.MaxBranchAge
+	if maxBranchAge == 0 {
+		maxBranchAge = policy.MinAge
+	}
+
+	plan := &Decisions{
+		Tags:    tags,
+		Reasons: map[string]Reason{},
+		ByTag:   map[string]Decision{},
+		Guard:   policy.Guard,
+		Force:   policy.Force,
+	}
+
+	// categorize tags - exceptions, tags, pull requests, branches
+	var keepTags []Tag
+	var branchTags []Tag
+	var deleteTags []Tag
+	var eligibleTags []Tag
+	var protectedTags []Tag
+	var pinnedTags []Tag
+	var labeledTags []Tag
+	reasons := plan.Reasons
+	for _, tag := range tags {
+		if rule, ok := protectedBy(policy.Protected, tag.Tag); ok {
+			protectedTags = append(protectedTags, tag) // exceptions - never delete
+			plan.decide(tag, KindProtected, false, "protected by rule %q", rule)
+		} else if pin, ok := pinnedBy(policy.Pins, tag.Tag, now); ok {
+			pinnedTags = append(pinnedTags, tag) // pinned - keep until the pin expires
+			plan.decide(tag, KindPinned, false, "%s", pinned(pin))
+		} else if explanation, ok := keptByLabel(policy.Labels[tag.ManifestDigest], now); ok {
+			labeledTags = append(labeledTags, tag) // labeled - keep as the image asks for
+			plan.decide(tag, KindLabeled, false, "%s", explanation)
+		} else if pr, ok := detect.PullRequest(tag.Tag, policy.PRPattern); ok {
+			if isClosedPR(pr, policy.OpenPRs) {
+				deleteTags = append(deleteTags, tag) // closed pull requests
+				reasons[tag.Tag] = ReasonPRClosed
+				plan.decide(tag, KindPullRequest, true, "deleted as pull request #%d which is closed", pr)
+			} else if !tag.UpdatedAt.After(now.Add(-prMaxAge)) {
+				deleteTags = append(deleteTags, tag) // outdated pull requests
+				reasons[tag.Tag] = ReasonPRAge
+				plan.decide(tag, KindPullRequest, true, "deleted as pull request #%d tag older than %d days", pr, days(prMaxAge))
+			} else {
+				eligible := !tag.UpdatedAt.After(now.Add(-policy.MinAge))
+				if eligible {
+					eligibleTags = append(eligibleTags, tag)
+				}
+				plan.decide(tag, KindPullRequest, false, "kept as pull request #%d, %s%s", pr, tooYoung(tag, prMaxAge, now), eligibleSuffix(eligible))
+			}
+		} else if detect.IsTag(tag.Tag) {
+			keepTags = append(keepTags, tag) // git tags
+		} else {
+			branchTags = append(branchTags, tag) // git branches
+		}
+	}
+
+	// Sort branches from the newest
+	slices.SortFunc(branchTags, func(a, b Tag) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+
+	// Keep the newest N branches within the maximum age
+	for i, tag := range branchTags {
+		if policy.KeepBranches > 0 && i >= policy.KeepBranches {
+			deleteTags = append(deleteTags, tag) // over the branch limit
+			reasons[tag.Tag] = ReasonBranchLimit
+			plan.decide(tag, KindBranch, true, "deleted as branch #%d, only the newest %d branches are kept", i+1, policy.KeepBranches)
+		} else if !tag.UpdatedAt.After(now.Add(-maxBranchAge)) {
+			deleteTags = append(deleteTags, tag) // branch is older than the maximum age
+			reasons[tag.Tag] = ReasonBranchAge
+			plan.decide(tag, KindBranch, true, "deleted as branch older than %d days", days(maxBranchAge))
+		} else if policy.KeepBranches > 0 {
+			plan.decide(tag, KindBranch, false, "kept as one of the newest %d branches (#%d), %s", policy.KeepBranches, i+1, tooYoung(tag, maxBranchAge, now))
+		} else {
+			eligible := !tag.UpdatedAt.After(now.Add(-policy.MinAge))
+			if eligible {
+				eligibleTags = append(eligibleTags, tag)
+			}
+			plan.decide(tag, KindBranch, false, "kept as branch, %s%s", tooYoung(tag, maxBranchAge, now), eligibleSuffix(eligible))
+		}
+	}
+
+	// Sort tags by date
+	slices.SortFunc(keepTags, func(a, b Tag) int {
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	})
+
+	// Keep the latest N tags
+	var releaseTagsToDelete []Tag
+
+	if policy.KeepTags > 0 && len(keepTags) > policy.KeepTags {
+		releaseTagsToDelete = keepTags[0 : len(keepTags)-policy.KeepTags]
+	}
+
+	for i, tag := range keepTags {
+		rank := len(keepTags) - i // newest is #1
+		if i < len(releaseTagsToDelete) {
+			reasons[tag.Tag] = ReasonReleaseLimit
+			plan.decide(tag, KindRelease, true, "deleted as release #%d, only the newest %d releases are kept", rank, policy.KeepTags)
+		} else {
+			plan.decide(tag, KindRelease, false, "kept as one of the newest %d releases (#%d)", policy.KeepTags, rank)
+		}
+	}
+
+	slices.SortFunc(eligibleTags, func(a, b Tag) int {
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	})
+
+	plan.Protected = protectedTags
+	plan.Pinned = pinnedTags
+	plan.Labeled = labeledTags
+	plan.Delete = append(releaseTagsToDelete, deleteTags...)
+	plan.Eligible = eligibleTags
+	plan.retain()
+
+	return plan
+}
+
+// protectedBy returns the protected name matching the tag.
+func protectedBy(protected []string, tag string) (string, bool) {
+	for _, protectedTag := range protected {
+		if strings.EqualFold(protectedTag, tag) {
+			return protectedTag, true
+		}
+	}
+	return "", false
+}
+
+// Candidates are the tags deleted by the plan or eligible for a storage target,
+// the labels of their images may still keep them.
+func (p *Decisions) Candidates() []Tag {
+	return slices.Concat(p.Delete, p.Eligible)
+}
+
+// pinnedBy returns the pin of the tag which has not expired at the time now.
+func pinnedBy(pins []Pin, tag string, now time.Time) (Pin, bool) {
+	for _, pin := range pins {
+		if pin.Tag == tag && pin.Until.After(now) {
+			return pin, true
+		}
+	}
+	return Pin{}, false
+}
+
+// isClosedPR reports whether the pull request is missing from the known list of open pull requests.
+func isClosedPR(pr int, openPRs []int) bool {
+	if openPRs == nil {
+		return false // open pull requests are unknown
+	}
+	return !slices.Contains(openPRs, pr)
+}
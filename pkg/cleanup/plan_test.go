@@ -0,0 +1,98 @@
+package cleanup
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// now is the time of the plans in tests
+var now = time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+
+func fakeTag(name string, age time.Duration) Tag {
+	return Tag{
+		Tag:            name,
+		ManifestDigest: "sha256:" + name,
+		CompressedSize: 100000,
+		Size:           200000,
+		UpdatedAt:      now.Add(-age),
+	}
+}
+
+func TestPlan(t *testing.T) {
+	day := 24 * time.Hour
+	tags := []Tag{
+		fakeTag("main", 90*day),
+		fakeTag("1.0.0", 60*day),
+		fakeTag("1.1.0", 50*day),
+		fakeTag("1.2.0", 40*day),
+		fakeTag("feature-old", 45*day),
+		fakeTag("feature-new", 10*day),
+		fakeTag("pr-1", 20*day),
+		fakeTag("pr-2", 5*day),
+		fakeTag("pr-3", day),
+	}
+
+	plan := Plan(tags, Policy{
+		Protected: []string{"MAIN"},
+		KeepTags:  2,
+		MinAge:    30 * day,
+		PRPattern: regexp.MustCompile(`^pr-(\d+)$`),
+		PRMaxAge:  14 * day,
+		OpenPRs:   []int{1, 3},
+	}, now)
+
+	assert.Empty(t, plan.Registry)
+	assert.Equal(t, tags, plan.Tags)
+	assert.Equal(t, []string{"main"}, TagNames(plan.Protected))
+	assert.ElementsMatch(t, []string{"1.0.0", "feature-old", "pr-1", "pr-2"}, TagNames(plan.Delete))
+	assert.Equal(t, map[string]Reason{
+		"1.0.0":       ReasonReleaseLimit,
+		"feature-old": ReasonBranchAge,
+		"pr-1":        ReasonPRAge,
+		"pr-2":        ReasonPRClosed,
+	}, plan.Reasons)
+	assert.Len(t, plan.ByTag, len(tags))
+}
+
+func TestPlan_Now(t *testing.T) {
+	day := 24 * time.Hour
+	tags := []Tag{fakeTag("feature-1", 20*day), fakeTag("feature-2", 5*day), fakeTag("feature-3", day)}
+	policy := Policy{MinAge: 30 * day}
+
+	assert.Empty(t, Plan(tags, policy, now).Delete)
+	// the same tags are deleted once they cross the age threshold, the newest manifest is always kept
+	assert.Equal(t, []string{"feature-1"}, TagNames(Plan(tags, policy, now.Add(10*day)).Delete))
+	assert.ElementsMatch(t, []string{"feature-1", "feature-2"}, TagNames(Plan(tags, policy, now.Add(60*day)).Delete))
+}
+
+func TestPlan_Pins(t *testing.T) {
+	day := 24 * time.Hour
+	tags := []Tag{
+		fakeTag("feature-incident", 60*day),
+		fakeTag("feature-expired", 60*day),
+		fakeTag("1.0.0", 50*day),
+		fakeTag("1.1.0", 40*day),
+		fakeTag("main", day),
+	}
+	tags[2].ManifestDigest = tags[0].ManifestDigest
+
+	plan := Plan(tags, Policy{
+		KeepTags: 1,
+		MinAge:   30 * day,
+		Pins: []Pin{
+			{Tag: "feature-incident", Until: now.Add(7 * day), Reason: "INC-42"},
+			{Tag: "feature-expired", Until: now.Add(-day)},
+		},
+	}, now)
+
+	assert.Equal(t, []string{"feature-incident"}, TagNames(plan.Pinned))
+	assert.Equal(t, []string{"feature-expired"}, TagNames(plan.Delete))
+	assert.Equal(t, Decision{Tag: "feature-incident", Kind: KindPinned, Explanation: "pinned until 2026-10-25: INC-42"}, plan.ByTag["feature-incident"])
+	assert.Equal(t, `kept as it shares the manifest with pinned tag "feature-incident"`, plan.ByTag["1.0.0"].Explanation)
+
+	// the tag is deleted once the pin expires
+	assert.Contains(t, TagNames(Plan(tags, Policy{KeepTags: 1, MinAge: 30 * day, Pins: []Pin{{Tag: "feature-incident", Until: now}}}, now).Delete), "feature-incident")
+}
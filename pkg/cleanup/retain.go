@@ -0,0 +1,47 @@
+package cleanup
+
+import (
+	"fmt"
+	"slices"
+)
+
+// retain keeps the tags of the most recently pushed manifest and of manifests shared with protected or pinned tags
+// whatever the retention policy decided, so that a repository is never emptied and protected images stay intact.
+func (p *Decisions) retain() {
+	retained := map[string]string{} // explanations by digest
+
+	var newest *Tag
+	for i, tag := range p.Tags {
+		if newest == nil || tag.UpdatedAt.After(newest.UpdatedAt) {
+			newest = &p.Tags[i]
+		}
+	}
+	if newest != nil && newest.ManifestDigest != "" {
+		retained[newest.ManifestDigest] = fmt.Sprintf("kept as the most recently pushed manifest (tag %q)", newest.Tag)
+	}
+
+	for _, tag := range p.Protected {
+		if tag.ManifestDigest != "" {
+			retained[tag.ManifestDigest] = fmt.Sprintf("kept as it shares the manifest with protected tag %q", tag.Tag)
+		}
+	}
+
+	for _, tag := range p.Pinned {
+		if _, ok := retained[tag.ManifestDigest]; !ok && tag.ManifestDigest != "" {
+			retained[tag.ManifestDigest] = fmt.Sprintf("kept as it shares the manifest with pinned tag %q", tag.Tag)
+		}
+	}
+
+	isRetained := func(tag Tag) bool {
+		explanation, ok := retained[tag.ManifestDigest]
+		if ok {
+			decision := p.ByTag[tag.Tag]
+			p.decide(tag, decision.Kind, false, "%s", explanation)
+			delete(p.Reasons, tag.Tag)
+		}
+		return ok
+	}
+
+	p.Delete = slices.DeleteFunc(p.Delete, isRetained)
+	p.Eligible = slices.DeleteFunc(p.Eligible, isRetained)
+}
@@ -0,0 +1,106 @@
+package cleanup
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withDigest(tag Tag, digest string) Tag {
+	tag.ManifestDigest = digest
+	return tag
+}
+
+func TestPlan_KeepsNewestManifest(t *testing.T) {
+	day := 24 * time.Hour
+	plan := Plan([]Tag{
+		fakeTag("feature-1", 40*day),
+		fakeTag("feature-2", 50*day),
+		fakeTag("feature-3", 60*day),
+	}, Policy{KeepTags: 1, MinAge: 30 * day}, now)
+	// a repository without a protected tag is never emptied
+	assert.ElementsMatch(t, []string{"feature-2", "feature-3"}, TagNames(plan.Delete))
+	assert.NotContains(t, plan.Reasons, "feature-1")
+
+	decision, _ := plan.Explain("feature-1")
+	assert.False(t, decision.Delete)
+	assert.Equal(t, KindBranch, decision.Kind)
+	assert.Equal(t, `kept as the most recently pushed manifest (tag "feature-1")`, decision.Explanation)
+}
+
+func TestPlan_KeepsTagsOfNewestManifest(t *testing.T) {
+	day := 24 * time.Hour
+	plan := Plan([]Tag{
+		withDigest(fakeTag("1.0.0", 10*day), "sha256:same"),
+		fakeTag("1.1.0", 9*day),
+		fakeTag("1.2.0", 8*day),
+		withDigest(fakeTag("feature", 2*day), "sha256:same"), // re-tagged release,
+	}, Policy{KeepTags: 1, MinAge: day}, now)
+	assert.Equal(t, []string{"1.1.0"}, TagNames(plan.Delete))
+}
+
+func TestPlan_KeepsManifestsOfProtectedTags(t *testing.T) {
+	day := 24 * time.Hour
+	plan := Plan([]Tag{
+		fakeTag("main-new", time.Hour),
+		withDigest(fakeTag("latest", 60*day), "sha256:release"),
+		withDigest(fakeTag("1.0.0", 60*day), "sha256:release"),
+		fakeTag("1.1.0", 50*day),
+		fakeTag("1.2.0", 40*day),
+		withDigest(fakeTag("prod", 45*day), "sha256:branch"),
+		withDigest(fakeTag("main-old", 45*day), "sha256:branch"),
+		fakeTag("feature", 45*day),
+	}, Policy{Protected: []string{"latest", "prod"}, KeepTags: 1, MinAge: 30 * day}, now)
+	assert.ElementsMatch(t, []string{"1.1.0", "feature"}, TagNames(plan.Delete))
+
+	decision, _ := plan.Explain("1.0.0")
+	assert.Equal(t, `kept as it shares the manifest with protected tag "latest"`, decision.Explanation)
+	decision, _ = plan.Explain("main-old")
+	assert.Equal(t, `kept as it shares the manifest with protected tag "prod"`, decision.Explanation)
+}
+
+func TestPlan_KeepsNewestClosedPullRequest(t *testing.T) {
+	day := 24 * time.Hour
+	plan := Plan([]Tag{
+		fakeTag("pr-1", day),
+		fakeTag("pr-2", 2*day),
+	}, Policy{
+		KeepTags:  1,
+		MinAge:    30 * day,
+		PRPattern: regexp.MustCompile(`^pr-(\d+)$`),
+		OpenPRs:   []int{},
+	}, now)
+	assert.Equal(t, []string{"pr-2"}, TagNames(plan.Delete))
+}
+
+func TestPlan_RetainedNotEligible(t *testing.T) {
+	day := 24 * time.Hour
+	plan := Plan([]Tag{
+		withDigest(fakeTag("latest", 100*day), "sha256:old"),
+		withDigest(fakeTag("feature-1", 40*day), "sha256:old"),
+		fakeTag("feature-2", 35*day),
+	}, Policy{Protected: []string{"latest"}, KeepTags: 1, MinAge: 30 * day, MaxBranchAge: 90 * day}, now)
+	assert.Empty(t, plan.Delete)
+	assert.Empty(t, plan.Eligible) // feature-2 is the newest manifest, feature-1 shares the manifest of latest
+
+	SelectForTarget([]*Decisions{plan}, 1000000, 0)
+	assert.Empty(t, plan.Delete)
+}
+
+func TestPlan_EmptyDigestNotShared(t *testing.T) {
+	day := 24 * time.Hour
+	plan := Plan([]Tag{
+		fakeTag("new", time.Hour),
+		withDigest(fakeTag("latest", 60*day), ""),
+		withDigest(fakeTag("feature", 60*day), ""),
+	}, Policy{Protected: []string{"latest"}, KeepTags: 1, MinAge: 30 * day}, now)
+	assert.Equal(t, []string{"feature"}, TagNames(plan.Delete))
+}
+
+func TestPlan_EmptyRepository(t *testing.T) {
+	plan := Plan([]Tag{}, Policy{KeepTags: 1, MinAge: time.Hour}, now)
+	assert.Empty(t, plan.Delete)
+	assert.Empty(t, plan.Eligible)
+}
@@ -0,0 +1,192 @@
+package cleanup
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"TB", 1000 * 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// UsageTarget is the storage usage a cleanup should get below,
+// either in bytes or as a percentage of the subscription storage limit.
+type UsageTarget struct {
+	Bytes   int64
+	Percent float64
+}
+
+// ParseUsageTarget parses targets such as "80%", "5GiB", "500MB" or "1073741824".
+func ParseUsageTarget(value string) (UsageTarget, error) {
+	value = strings.TrimSpace(value)
+
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		p, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return UsageTarget{}, fmt.Errorf("invalid usage target %q: percentage must be between 0 and 100", value)
+		}
+		return UsageTarget{Percent: p}, nil
+	}
+
+	multiplier := int64(1)
+	number := value
+	for _, unit := range sizeUnits {
+		if n, ok := strings.CutSuffix(value, unit.suffix); ok {
+			number, multiplier = strings.TrimSpace(n), unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size <= 0 {
+		return UsageTarget{}, fmt.Errorf("invalid usage target %q: expected a percentage or a size such as 5GiB", value)
+	}
+
+	return UsageTarget{Bytes: int64(size * float64(multiplier))}, nil
+}
+
+// Resolve returns the target in bytes, percentages are relative to the storage limit.
+func (t UsageTarget) Resolve(limit int64) (int64, error) {
+	if t.Percent == 0 {
+		return t.Bytes, nil
+	}
+
+	if limit <= 0 {
+		return 0, fmt.Errorf("storage limit of the subscription is unknown, use a target in bytes")
+	}
+
+	return int64(float64(limit) * t.Percent / 100), nil
+}
+
+func (t UsageTarget) String() string {
+	if t.Percent != 0 {
+		return strconv.FormatFloat(t.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.FormatInt(t.Bytes, 10) + "B"
+}
+
+// FormatBytes formats a size in binary units, e.g. 1.5 GiB.
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit && size > -unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size)
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := -1
+	for value >= unit || value <= -unit {
+		value /= unit
+		i++
+		if i == len(units)-1 {
+			break
+		}
+	}
+
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+// EstimateFreedBytes estimates the storage released by deleting the planned tags.
+// Each manifest is counted once and a manifest still referenced by a kept tag releases nothing.
+// Layers shared between manifests are not known, so the estimate is an upper bound.
+func (p *Decisions) EstimateFreedBytes() int64 {
+	kept := p.keptDigests()
+
+	var freed int64
+	counted := map[string]bool{}
+	for _, tag := range p.Delete {
+		if kept[tag.ManifestDigest] > 0 || counted[tag.ManifestDigest] {
+			continue
+		}
+		counted[tag.ManifestDigest] = true
+		freed += int64(tag.CompressedSize)
+	}
+
+	return freed
+}
+
+// keptDigests counts the kept tags referencing each manifest.
+func (p *Decisions) keptDigests() map[string]int {
+	deleted := make(map[string]bool, len(p.Delete))
+	for _, tag := range p.Delete {
+		deleted[tag.Tag] = true
+	}
+
+	kept := map[string]int{}
+	for _, tag := range p.Tags {
+		if !deleted[tag.Tag] {
+			kept[tag.ManifestDigest]++
+		}
+	}
+	return kept
+}
+
+// SelectForTarget moves eligible tags of the plans to their deletions, from the oldest across all plans,
+// until the projected storage usage falls to the target. Returns the projected usage after the cleanup.
+func SelectForTarget(plans []*Decisions, usage, target int64) int64 {
+	type candidate struct {
+		plan *Decisions
+		tag  Tag
+	}
+
+	projected := usage
+	kept := make(map[*Decisions]map[string]int, len(plans))
+	var candidates []candidate
+	for _, plan := range plans {
+		projected -= plan.EstimateFreedBytes()
+		kept[plan] = plan.keptDigests()
+		for _, tag := range plan.Eligible {
+			candidates = append(candidates, candidate{plan: plan, tag: tag})
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return a.tag.UpdatedAt.Compare(b.tag.UpdatedAt)
+	})
+
+	selected := map[*Decisions]map[string]bool{}
+	for _, candidate := range candidates {
+		if projected <= target {
+			break
+		}
+
+		plan := candidate.plan
+		plan.Delete = append(plan.Delete, candidate.tag)
+		if plan.Reasons == nil {
+			plan.Reasons = map[string]Reason{}
+		}
+		plan.Reasons[candidate.tag.Tag] = ReasonUsageTarget
+		decision := plan.ByTag[candidate.tag.Tag]
+		plan.decide(candidate.tag, decision.Kind, true, "deleted as one of the oldest eligible tags to reach the storage target")
+		if selected[plan] == nil {
+			selected[plan] = map[string]bool{}
+		}
+		selected[plan][candidate.tag.Tag] = true
+
+		// the manifest is freed once no kept tag references it
+		digest := candidate.tag.ManifestDigest
+		kept[plan][digest]--
+		if kept[plan][digest] == 0 {
+			projected -= int64(candidate.tag.CompressedSize)
+		}
+	}
+
+	for plan, tags := range selected {
+		plan.Eligible = slices.DeleteFunc(plan.Eligible, func(tag Tag) bool { return tags[tag.Tag] })
+	}
+
+	return projected
+}
@@ -0,0 +1,166 @@
+package cleanup
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUsageTarget(t *testing.T) {
+	valid := map[string]UsageTarget{
+		"80%":        {Percent: 80},
+		"12.5%":      {Percent: 12.5},
+		"1073741824": {Bytes: 1 << 30},
+		"5GiB":       {Bytes: 5 << 30},
+		"1.5 GiB":    {Bytes: 3 << 29},
+		"500MB":      {Bytes: 500 * 1000 * 1000},
+		"100B":       {Bytes: 100},
+	}
+
+	for value, expected := range valid {
+		target, err := ParseUsageTarget(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, target, value)
+	}
+
+	for _, value := range []string{"", "0%", "101%", "-5GiB", "five", "5XB"} {
+		_, err := ParseUsageTarget(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestUsageTarget_Resolve(t *testing.T) {
+	target, err := UsageTarget{Percent: 80}.Resolve(1000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(800), target)
+
+	target, err = UsageTarget{Bytes: 500}.Resolve(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(500), target)
+
+	_, err = UsageTarget{Percent: 80}.Resolve(0)
+	assert.Error(t, err)
+}
+
+func TestEstimateFreedBytes(t *testing.T) {
+	tag := func(name, digest string, size int) Tag {
+		return Tag{Tag: name, ManifestDigest: digest, CompressedSize: size}
+	}
+
+	plan := &Decisions{
+		Tags: []Tag{
+			tag("a", "sha256:1", 100),
+			tag("b", "sha256:1", 100),
+			tag("c", "sha256:2", 200),
+			tag("d", "sha256:3", 300),
+			tag("e", "sha256:3", 300),
+		},
+		Delete: []Tag{
+			tag("a", "sha256:1", 100),
+			tag("c", "sha256:2", 200),
+			tag("d", "sha256:3", 300),
+			tag("e", "sha256:3", 300),
+		},
+	}
+
+	// sha256:1 is still referenced by b, sha256:3 is counted once
+	assert.Equal(t, int64(500), plan.EstimateFreedBytes())
+}
+
+func TestSelectForTarget(t *testing.T) {
+	tag := func(name string, ageDays int, size int) Tag {
+		return Tag{
+			Tag:            name,
+			ManifestDigest: "sha256:" + name,
+			CompressedSize: size,
+			UpdatedAt:      now.Add(-time.Duration(ageDays) * 24 * time.Hour),
+		}
+	}
+
+	backend := &Decisions{
+		Repository: "backend",
+		Tags:       []Tag{tag("b-old", 90, 100), tag("b-mid", 50, 100), tag("b-new", 40, 100)},
+		Delete:     []Tag{tag("b-old", 90, 100)},
+		Eligible:   []Tag{tag("b-mid", 50, 100), tag("b-new", 40, 100)},
+	}
+	frontend := &Decisions{
+		Repository: "frontend",
+		Tags:       []Tag{tag("f-old", 60, 100), tag("f-new", 35, 100)},
+		Eligible:   []Tag{tag("f-old", 60, 100), tag("f-new", 35, 100)},
+	}
+
+	projected := SelectForTarget([]*Decisions{backend, frontend}, 1000, 750)
+
+	// b-old is deleted by the policy, then f-old and b-mid as the oldest eligible tags
+	assert.Equal(t, int64(700), projected)
+	assert.Equal(t, []string{"b-old", "b-mid"}, TagNames(backend.Delete))
+	assert.Equal(t, []string{"b-new"}, TagNames(backend.Eligible))
+	assert.Equal(t, []string{"f-old"}, TagNames(frontend.Delete))
+	assert.Equal(t, []string{"f-new"}, TagNames(frontend.Eligible))
+	assert.Equal(t, ReasonUsageTarget, backend.Reasons["b-mid"])
+}
+
+func TestSelectForTarget_SharedManifest(t *testing.T) {
+	shared := func(name string, ageDays int) Tag {
+		return Tag{Tag: name, ManifestDigest: "sha256:shared", CompressedSize: 100, UpdatedAt: now.Add(-time.Duration(ageDays) * 24 * time.Hour)}
+	}
+	plan := &Decisions{
+		Tags:     []Tag{shared("a", 90), shared("b", 80), shared("c", 70)},
+		Delete:   []Tag{shared("a", 90)},
+		Eligible: []Tag{shared("b", 80), shared("c", 70)},
+	}
+
+	// the manifest is freed once its last tag is deleted
+	projected := SelectForTarget([]*Decisions{plan}, 1000, 950)
+
+	assert.Equal(t, int64(900), projected)
+	assert.Equal(t, []string{"a", "b", "c"}, TagNames(plan.Delete))
+	assert.Empty(t, plan.Eligible)
+}
+
+func TestSelectForTarget_BelowTarget(t *testing.T) {
+	plan := &Decisions{
+		Tags:     []Tag{{Tag: "a", ManifestDigest: "sha256:a", CompressedSize: 100}},
+		Eligible: []Tag{{Tag: "a", ManifestDigest: "sha256:a", CompressedSize: 100}},
+	}
+
+	projected := SelectForTarget([]*Decisions{plan}, 500, 800)
+
+	assert.Equal(t, int64(500), projected)
+	assert.Empty(t, plan.Delete)
+}
+
+func TestPlan_Eligible(t *testing.T) {
+	const day = 24 * time.Hour
+	plan := Plan([]Tag{
+		fakeTag("main", 90*day),
+		fakeTag("1.0.0", 90*day),
+		fakeTag("1.1.0", 80*day),
+		fakeTag("feature-old", 40*day),
+		fakeTag("feature-mid", 20*day),
+		fakeTag("feature-new", 1*day),
+		fakeTag("pr-1", 20*day),
+	}, Policy{
+		Protected:    []string{"main"},
+		KeepTags:     1,
+		MinAge:       14 * day,
+		MaxBranchAge: 30 * day,
+		PRPattern:    regexp.MustCompile(`^pr-(\d+)$`),
+		PRMaxAge:     30 * day,
+	}, now)
+	assert.ElementsMatch(t, []string{"1.0.0", "feature-old"}, TagNames(plan.Delete))
+	assert.Equal(t, ReasonReleaseLimit, plan.Reasons["1.0.0"])
+	assert.Equal(t, ReasonBranchAge, plan.Reasons["feature-old"])
+	// protected tags, kept releases and tags younger than MinAge are never eligible
+	assert.ElementsMatch(t, []string{"feature-mid", "pr-1"}, TagNames(plan.Eligible))
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", FormatBytes(512))
+	assert.Equal(t, "1.5 KiB", FormatBytes(1536))
+	assert.Equal(t, "50.0 MiB", FormatBytes(50<<20))
+	assert.Equal(t, "2.0 TiB", FormatBytes(2<<40))
+	assert.Equal(t, "-1.0 GiB", FormatBytes(-1<<30))
+}
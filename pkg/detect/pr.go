@@ -0,0 +1,30 @@
+package detect
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// DefaultPullRequestPattern matches tags pushed by CI for pull requests, e.g. pr-123.
+// The first capture group must contain the pull request number.
+const DefaultPullRequestPattern = `^pr-(\d+)$`
+
+// PullRequest reports whether the tag matches the pull request pattern
+// and returns the pull request number extracted from the first capture group.
+func PullRequest(tag string, pattern *regexp.Regexp) (int, bool) {
+	if pattern == nil {
+		return 0, false
+	}
+
+	match := pattern.FindStringSubmatch(tag)
+	if match == nil || len(match) < 2 {
+		return 0, false
+	}
+
+	number, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, false
+	}
+
+	return number, true
+}
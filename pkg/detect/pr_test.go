@@ -0,0 +1,54 @@
+package detect
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPullRequest(t *testing.T) {
+	pattern := regexp.MustCompile(DefaultPullRequestPattern)
+
+	validTags := map[string]int{
+		"pr-1":     1,
+		"pr-42":    42,
+		"pr-12345": 12345,
+	}
+
+	invalidTags := []string{
+		"pr-",
+		"pr-abc",
+		"pr-42-fix",
+		"feature-pr-42",
+		"PR-42",
+		"1.2.3",
+		"main",
+	}
+
+	for tag, expected := range validTags {
+		number, ok := PullRequest(tag, pattern)
+		assert.True(t, ok, fmt.Sprintf("%q is a pull request tag", tag))
+		assert.Equal(t, expected, number)
+	}
+
+	for _, tag := range invalidTags {
+		_, ok := PullRequest(tag, pattern)
+		assert.False(t, ok, fmt.Sprintf("%q is not a pull request tag", tag))
+	}
+}
+
+func TestPullRequest_CustomPattern(t *testing.T) {
+	pattern := regexp.MustCompile(`^preview-(\d+)-[0-9a-f]{7}$`)
+
+	number, ok := PullRequest("preview-7-abcdef1", pattern)
+	assert.True(t, ok)
+	assert.Equal(t, 7, number)
+
+	_, ok = PullRequest("pr-7", pattern)
+	assert.False(t, ok)
+
+	_, ok = PullRequest("pr-7", nil)
+	assert.False(t, ok)
+}
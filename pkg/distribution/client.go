@@ -0,0 +1,262 @@
+package distribution
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultHost is the host of the DigitalOcean Container Registry.
+const DefaultHost = "registry.digitalocean.com"
+
+// ErrNotFound is returned when the manifest or blob does not exist (anymore).
+var ErrNotFound = errors.New("not found")
+
+// manifestMediaTypes are accepted when fetching manifests, so the registry returns them unchanged.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Client talks to a container registry via the Docker Registry HTTP API V2.
+// The DigitalOcean API token is used as both the username and the password.
+type Client struct {
+	baseURL string
+	token   string
+	client  *http.Client
+
+	mu           sync.Mutex
+	bearer       map[string]string            // bearer tokens by scope
+	cachedLabels map[string]map[string]string // image labels by repository@digest
+}
+
+// Manifest is a raw image manifest as stored in the registry.
+type Manifest struct {
+	MediaType string
+	Digest    string
+	Body      []byte
+}
+
+// NewClient creates a client for the registry host, e.g. registry.digitalocean.com.
+// A host with a scheme (http://localhost:5000) is used as is, otherwise https is assumed.
+func NewClient(host, token string) *Client {
+	baseURL := host
+	if !strings.Contains(host, "://") {
+		baseURL = "https://" + host
+	}
+
+	return &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		token:        token,
+		client:       http.DefaultClient,
+		bearer:       map[string]string{},
+		cachedLabels: map[string]map[string]string{},
+	}
+}
+
+// GetManifest fetches the manifest by tag or digest, the repository includes the registry name (registry/repository).
+func (c *Client) GetManifest(repository, reference string) (*Manifest, error) {
+	resp, err := c.do(http.MethodGet, repository, "/manifests/"+reference, nil, map[string]string{
+		"Accept": strings.Join(manifestMediaTypes, ", "),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read response body: %w", err)
+	}
+
+	return &Manifest{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    resp.Header.Get("Docker-Content-Digest"),
+		Body:      body,
+	}, nil
+}
+
+// PutManifest uploads the manifest under the tag.
+func (c *Client) PutManifest(repository, tag string, manifest *Manifest) error {
+	resp, err := c.do(http.MethodPut, repository, "/manifests/"+tag, manifest.Body, map[string]string{
+		"Content-Type": manifest.MediaType,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Tag points the tag to the manifest with the digest, the manifest must still be present in the registry.
+func (c *Client) Tag(repository, tag, digest string) error {
+	manifest, err := c.GetManifest(repository, digest)
+	if err != nil {
+		return fmt.Errorf("could not get manifest %s: %w", digest, err)
+	}
+
+	if err := c.PutManifest(repository, tag, manifest); err != nil {
+		return fmt.Errorf("could not put manifest %s: %w", digest, err)
+	}
+
+	return nil
+}
+
+// do sends the request and answers the authentication challenge of the registry if needed.
+func (c *Client) do(method, repository, path string, body []byte, header map[string]string) (*http.Response, error) {
+	scope := "repository:" + repository + ":pull"
+	if method != http.MethodGet && method != http.MethodHead {
+		scope += ",push"
+	}
+
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequest(method, c.baseURL+"/v2/"+repository+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("could not create request: %w", err)
+		}
+
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		req.Header.Set("User-Agent", "digitalocean-registry-cleaner")
+
+		c.mu.Lock()
+		bearer, ok := c.bearer[scope]
+		c.mu.Unlock()
+
+		if ok {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		} else {
+			req.SetBasicAuth(c.token, c.token)
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("could not send request: %w", err)
+		}
+
+		return resp, nil
+	}
+
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return nil, fmt.Errorf("unauthorized: check the token has registry access")
+	}
+
+	if err := c.authenticate(challenge, scope); err != nil {
+		return nil, err
+	}
+
+	return send()
+}
+
+// authenticate fetches a bearer token from the realm of the challenge, e.g.
+// Bearer realm="https://api.digitalocean.com/v2/registry/auth",service="registry.digitalocean.com"
+func (c *Client) authenticate(challenge, scope string) error {
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+	if params["realm"] == "" {
+		return fmt.Errorf("invalid authentication challenge: %s", challenge)
+	}
+
+	query := url.Values{}
+	query.Set("scope", scope)
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+
+	req.SetBasicAuth(c.token, c.token)
+	req.Header.Set("User-Agent", "digitalocean-registry-cleaner")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not authenticate to the registry: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var output struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&output); err != nil {
+		return fmt.Errorf("could not unmarshal response body: %w", err)
+	}
+
+	token := output.Token
+	if token == "" {
+		token = output.AccessToken
+	}
+
+	c.mu.Lock()
+	c.bearer[scope] = token
+	c.mu.Unlock()
+
+	return nil
+}
+
+// parseChallenge parses comma separated key="value" pairs of the WWW-Authenticate header.
+func parseChallenge(value string) map[string]string {
+	params := map[string]string{}
+	for value != "" {
+		key, rest, ok := strings.Cut(value, "=")
+		if !ok {
+			break
+		}
+		key = strings.TrimSpace(key)
+
+		var param string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			param, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			param, rest, _ = strings.Cut(rest, ",")
+		}
+
+		params[key] = param
+		value = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return params
+}
@@ -0,0 +1,131 @@
+package distribution
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRegistry is an in-memory stand-in for registry.digitalocean.com with token authentication
+type fakeRegistry struct {
+	mu        sync.Mutex
+	server    *httptest.Server
+	manifests map[string]*Manifest // by repository@reference
+	blobs     map[string][]byte    // by repository@digest
+	scopes    []string
+	requests  int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/auth" {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "test-token" || pass != "test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.scopes = append(f.scopes, r.URL.Query().Get("scope"))
+		_, _ = w.Write([]byte(`{"token":"bearer-token"}`))
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer bearer-token" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+f.server.URL+`/auth",service="registry.digitalocean.com"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.requests++
+	if repository, digest, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/blobs/"); ok {
+		blob, ok := f.blobs[repository+"@"+digest]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(blob)
+		return
+	}
+
+	repository, reference, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		manifest, ok := f.manifests[repository+"@"+reference]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", manifest.MediaType)
+		w.Header().Set("Docker-Content-Digest", manifest.Digest)
+		_, _ = w.Write(manifest.Body)
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.manifests[repository+"@"+reference] = &Manifest{MediaType: r.Header.Get("Content-Type"), Body: body}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeRegistry(t *testing.T) (*Client, *fakeRegistry) {
+	fake := &fakeRegistry{manifests: map[string]*Manifest{}, blobs: map[string][]byte{}}
+	fake.server = httptest.NewServer(fake)
+	t.Cleanup(fake.server.Close)
+
+	return NewClient(fake.server.URL, "test-token"), fake
+}
+
+func TestTag(t *testing.T) {
+	client, fake := newFakeRegistry(t)
+	fake.manifests["my-registry/backend@sha256:abc"] = &Manifest{
+		MediaType: "application/vnd.oci.image.manifest.v1+json",
+		Digest:    "sha256:abc",
+		Body:      []byte(`{"schemaVersion":2}`),
+	}
+
+	err := client.Tag("my-registry/backend", "feature-x", "sha256:abc")
+
+	assert.NoError(t, err)
+	restored := fake.manifests["my-registry/backend@feature-x"]
+	assert.Equal(t, "application/vnd.oci.image.manifest.v1+json", restored.MediaType)
+	assert.Equal(t, []byte(`{"schemaVersion":2}`), restored.Body)
+	assert.Equal(t, []string{"repository:my-registry/backend:pull", "repository:my-registry/backend:pull,push"}, fake.scopes)
+}
+
+func TestTag_ManifestGone(t *testing.T) {
+	client, _ := newFakeRegistry(t)
+
+	err := client.Tag("my-registry/backend", "feature-x", "sha256:gone")
+
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestGetManifest_Unauthorized(t *testing.T) {
+	client, fake := newFakeRegistry(t)
+	client = NewClient(fake.server.URL, "wrong-token")
+
+	_, err := client.GetManifest("my-registry/backend", "latest")
+
+	assert.Error(t, err)
+}
+
+func TestParseChallenge(t *testing.T) {
+	params := parseChallenge(`realm="https://api.digitalocean.com/v2/registry/auth",service="registry.digitalocean.com",scope="repository:a/b:pull,push"`)
+
+	assert.Equal(t, map[string]string{
+		"realm":   "https://api.digitalocean.com/v2/registry/auth",
+		"service": "registry.digitalocean.com",
+		"scope":   "repository:a/b:pull,push",
+	}, params)
+}
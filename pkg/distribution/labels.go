@@ -0,0 +1,119 @@
+package distribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxBlobSize bounds blobs read into memory, image configs are a few kilobytes.
+const maxBlobSize = 4 << 20
+
+// GetBlob fetches the blob with the digest, e.g. an image config.
+func (c *Client) GetBlob(repository, digest string) ([]byte, error) {
+	resp, err := c.do(http.MethodGet, repository, "/blobs/"+digest, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBlobSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not read response body: %w", err)
+	}
+	if len(body) > maxBlobSize {
+		return nil, fmt.Errorf("blob %s exceeds %d bytes", digest, maxBlobSize)
+	}
+
+	return body, nil
+}
+
+// Labels returns the labels of the image config of the manifest (LABEL instructions of the Dockerfile).
+// The labels of an index are the labels of its first platform image. Labels are cached by digest.
+func (c *Client) Labels(repository, reference string) (map[string]string, error) {
+	key := repository + "@" + reference
+	c.mu.Lock()
+	labels, ok := c.cachedLabels[key]
+	c.mu.Unlock()
+	if ok {
+		return labels, nil
+	}
+
+	labels, err := c.readLabels(repository, reference, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(reference, "sha256:") {
+		c.mu.Lock()
+		c.cachedLabels[key] = labels
+		c.mu.Unlock()
+	}
+
+	return labels, nil
+}
+
+// readLabels reads the image config of the manifest, an index is resolved once.
+func (c *Client) readLabels(repository, reference string, resolveIndex bool) (map[string]string, error) {
+	manifest, err := c.GetManifest(repository, reference)
+	if err != nil {
+		return nil, fmt.Errorf("could not get manifest %s: %w", reference, err)
+	}
+
+	var content struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Manifests []struct {
+			Digest   string `json:"digest"`
+			Platform struct {
+				OS string `json:"os"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(manifest.Body, &content); err != nil {
+		return nil, fmt.Errorf("could not unmarshal manifest %s: %w", reference, err)
+	}
+
+	if len(content.Manifests) > 0 {
+		if !resolveIndex {
+			return nil, fmt.Errorf("manifest %s is a nested index", reference)
+		}
+		for _, m := range content.Manifests {
+			if m.Platform.OS != "unknown" { // attestations are not images
+				return c.readLabels(repository, m.Digest, false)
+			}
+		}
+		return nil, nil
+	}
+
+	if content.Config.Digest == "" {
+		return nil, fmt.Errorf("manifest %s has no config", reference)
+	}
+
+	body, err := c.GetBlob(repository, content.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("could not get config %s: %w", content.Config.Digest, err)
+	}
+
+	var config struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("could not unmarshal config %s: %w", content.Config.Digest, err)
+	}
+
+	return config.Config.Labels, nil
+}
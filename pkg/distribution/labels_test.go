@@ -0,0 +1,76 @@
+package distribution
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// addImage stores an image manifest of the repository whose config has the labels
+func addImage(fake *fakeRegistry, repository, digest, config string) {
+	fake.manifests[repository+"@"+digest] = &Manifest{
+		MediaType: "application/vnd.oci.image.manifest.v1+json",
+		Digest:    digest,
+		Body:      []byte(`{"schemaVersion":2,"config":{"digest":"sha256:config-` + digest + `"}}`),
+	}
+	fake.blobs[repository+"@sha256:config-"+digest] = []byte(config)
+}
+
+func TestLabels(t *testing.T) {
+	client, fake := newFakeRegistry(t)
+	addImage(fake, "my-registry/backend", "sha256:abc", `{"architecture":"amd64","config":{"Labels":{"dorc.keep":"true"}}}`)
+
+	labels, err := client.Labels("my-registry/backend", "sha256:abc")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"dorc.keep": "true"}, labels)
+
+	// labels of a digest never change
+	requests := fake.requests
+	labels, err = client.Labels("my-registry/backend", "sha256:abc")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"dorc.keep": "true"}, labels)
+	assert.Equal(t, requests, fake.requests)
+}
+
+func TestLabels_Index(t *testing.T) {
+	client, fake := newFakeRegistry(t)
+	addImage(fake, "my-registry/backend", "sha256:amd64", `{"config":{"Labels":{"dorc.expires":"2026-12-31"}}}`)
+	fake.manifests["my-registry/backend@sha256:index"] = &Manifest{
+		MediaType: "application/vnd.oci.image.index.v1+json",
+		Digest:    "sha256:index",
+		Body: []byte(`{"schemaVersion":2,"manifests":[
+			{"digest":"sha256:attestation","platform":{"os":"unknown","architecture":"unknown"}},
+			{"digest":"sha256:amd64","platform":{"os":"linux","architecture":"amd64"}}
+		]}`),
+	}
+
+	labels, err := client.Labels("my-registry/backend", "sha256:index")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"dorc.expires": "2026-12-31"}, labels)
+}
+
+func TestLabels_NoLabels(t *testing.T) {
+	client, fake := newFakeRegistry(t)
+	addImage(fake, "my-registry/backend", "sha256:abc", `{"config":{}}`)
+
+	labels, err := client.Labels("my-registry/backend", "sha256:abc")
+	assert.NoError(t, err)
+	assert.Empty(t, labels)
+}
+
+func TestLabels_ManifestGone(t *testing.T) {
+	client, _ := newFakeRegistry(t)
+
+	_, err := client.Labels("my-registry/backend", "sha256:gone")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLabels_ConfigGone(t *testing.T) {
+	client, fake := newFakeRegistry(t)
+	addImage(fake, "my-registry/backend", "sha256:abc", "")
+	delete(fake.blobs, "my-registry/backend@sha256:config-sha256:abc")
+
+	_, err := client.Labels("my-registry/backend", "sha256:abc")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorContains(t, err, "could not get config")
+}
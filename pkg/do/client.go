@@ -1,184 +1,440 @@
+// Package do is a client of the DigitalOcean Container Registry API: repositories, tags, manifests and garbage collection.
+//
+// The retention policy lives in package cleanup, PlanCleanup and RunCleanup combine both for a single repository.
 package do
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"slices"
-	"strings"
+	"strconv"
 	"time"
 
-	"digitalocean-registry-cleaner/pkg/detect"
+	"digitalocean-registry-cleaner/pkg/cleanup"
+)
+
+const (
+	apiURL = "https://api.digitalocean.com"
+
+	// perPage is the page size of list requests, the maximum of the DigitalOcean API.
+	perPage = 200
+
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+	maxRetryDelay     = time.Minute
 )
 
 type DigitalOceanClient struct {
-	token     string
-	protected []string
-	client    *http.Client
+	token      string
+	tokens     func() (string, error)
+	protected  []string
+	client     *http.Client
+	observer   func(RequestEvent)
+	logger     *slog.Logger
+	maxRetries int
+	backoff    time.Duration
+	now        func() time.Time
+	pins       func(registry, repository string) ([]cleanup.Pin, error)
+	labels     func(registry, repository, digest string) (map[string]string, error)
 }
 
-type Tag struct {
-	Tag            string    `json:"tag"`
-	ManifestDigest string    `json:"manifest_digest"`
-	CompressedSize int       `json:"compressed_size_bytes"`
-	Size           int       `json:"size_bytes"`
-	UpdatedAt      time.Time `json:"updated_at"`
+// RequestEvent describes a single attempt of an API request.
+type RequestEvent struct {
+	Method  string
+	Path    string
+	Status  int // zero if no response was received
+	Latency time.Duration
+	Attempt int // retries have attempt greater than 1
+	Err     error
 }
 
+// CleanupInput is the repository and the retention policy of a cleanup.
+// Protected and Pins of the policy are set by the client, see NewClient and SetPins.
 type CleanupInput struct {
 	Registry   string
 	Repository string
 	DryRun     bool
-	KeepTags   int
-	MinAge     time.Duration
+
+	cleanup.Policy
 }
 
 func NewClient(token string, protected []string) *DigitalOceanClient {
 	return &DigitalOceanClient{
-		token:     token,
-		protected: protected,
-		client:    http.DefaultClient,
+		token:      token,
+		protected:  protected,
+		client:     http.DefaultClient,
+		logger:     slog.Default(),
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+		now:        time.Now,
 	}
 }
 
+// OnRequest registers a function called after every API request attempt.
+func (c *DigitalOceanClient) OnRequest(observer func(RequestEvent)) {
+	c.observer = observer
+}
+
+// SetTokenSource sets a function returning the token of every request, e.g. to pick up a rotated token.
+func (c *DigitalOceanClient) SetTokenSource(tokens func() (string, error)) {
+	c.tokens = tokens
+}
+
+// SetClock sets the function returning the current time of cleanup plans, time.Now by default.
+// A clock in the future simulates which tags a later run deletes.
+func (c *DigitalOceanClient) SetClock(now func() time.Time) {
+	c.now = now
+}
+
+// SetPins sets a function returning the pins of a repository, it is consulted by every cleanup plan.
+func (c *DigitalOceanClient) SetPins(pins func(registry, repository string) ([]cleanup.Pin, error)) {
+	c.pins = pins
+}
+
+// SetLabels sets a function returning the labels of an image, e.g. from the Docker Registry v2 API.
+// Labels of the images of tags about to be deleted are read by every cleanup plan, see cleanup.LabelKeep.
+func (c *DigitalOceanClient) SetLabels(labels func(registry, repository, digest string) (map[string]string, error)) {
+	c.labels = labels
+}
+
+// SetLogger sets the logger of API requests, classification decisions and deletions, slog.Default() by default.
+func (c *DigitalOceanClient) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
 // RunCleanup deletes outdated tags and branches from the registry.
 // Returns a list of deleted tags.
-func (c *DigitalOceanClient) RunCleanup(input CleanupInput) ([]Tag, error) {
-	tags, err := c.listTags(input.Registry, input.Repository)
+func (c *DigitalOceanClient) RunCleanup(input CleanupInput) ([]cleanup.Tag, error) {
+	plan, err := c.PlanCleanup(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.ExecutePlan(plan, input.DryRun)
+}
+
+// PlanCleanup lists tags of the repository and decides which of them are deleted.
+func (c *DigitalOceanClient) PlanCleanup(input CleanupInput) (*cleanup.Decisions, error) {
+	tags, err := c.ListTags(input.Registry, input.Repository)
 	if err != nil {
 		return nil, fmt.Errorf("could not list tags: %w", err)
 	}
 
-	// categorize tags - exceptions, tags, branches
-	var keepTags []Tag
-	var deleteTags []Tag
-	for _, tag := range tags {
-		if c.isProtected(tag.Tag) {
-			continue // exceptions - never delete
-		} else if detect.IsTag(tag.Tag) {
-			keepTags = append(keepTags, tag) // git tags
-		} else if tag.UpdatedAt.After(time.Now().Add(-input.MinAge)) {
-			continue // tag is newer than the minimum age
-		} else {
-			deleteTags = append(deleteTags, tag) // git branches
+	policy, err := c.policy(input)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	plan := cleanup.Plan(tags, policy, now)
+	if c.labels != nil {
+		// the labels of the candidates may keep some of them, which never adds candidates
+		policy.Labels, err = c.imageLabels(input, plan.Candidates())
+		if err != nil {
+			return nil, err
+		}
+		if len(policy.Labels) > 0 {
+			plan = cleanup.Plan(tags, policy, now)
 		}
 	}
+	plan.Registry = input.Registry
+	plan.Repository = input.Repository
+	c.logPlan(plan)
 
-	// Sort tags by date
-	slices.SortFunc(keepTags, func(a, b Tag) int {
-		return a.UpdatedAt.Compare(b.UpdatedAt)
-	})
+	return plan, nil
+}
 
-	// Keep the latest N tags
-	var releaseTagsToDelete []Tag
+// ForecastCleanup lists the tags of the repository which the policy of the input deletes within the window.
+func (c *DigitalOceanClient) ForecastCleanup(input CleanupInput, window time.Duration) ([]cleanup.Upcoming, error) {
+	tags, err := c.ListTags(input.Registry, input.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("could not list tags: %w", err)
+	}
+
+	policy, err := c.policy(input)
+	if err != nil {
+		return nil, err
+	}
 
-	if input.KeepTags > 0 && len(keepTags) > input.KeepTags {
-		releaseTagsToDelete = keepTags[0 : len(keepTags)-input.KeepTags]
+	now := c.now()
+	if c.labels != nil {
+		candidates := cleanup.Plan(tags, policy, now).Candidates()
+		for _, upcoming := range cleanup.Forecast(tags, policy, now, now.Add(window)) {
+			candidates = append(candidates, upcoming.Tag)
+		}
+		policy.Labels, err = c.imageLabels(input, candidates)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	var deletedTags []Tag
+	return cleanup.Forecast(tags, policy, now, now.Add(window)), nil
+}
+
+// imageLabels returns the retention labels of the images of the tags by manifest digest.
+func (c *DigitalOceanClient) imageLabels(input CleanupInput, tags []cleanup.Tag) (map[string]map[string]string, error) {
+	result := map[string]map[string]string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		if tag.ManifestDigest == "" || seen[tag.ManifestDigest] {
+			continue
+		}
+		seen[tag.ManifestDigest] = true
 
-	// Delete outdated tags
-	for _, tag := range releaseTagsToDelete {
-		if !input.DryRun {
-			if err := c.deleteTag(input.Registry, input.Repository, tag.Tag); err != nil {
-				return deletedTags, fmt.Errorf("could not delete tag %s.%s:%s : %w", input.Registry, input.Repository, tag.Tag, err)
-			}
+		labels, err := c.labels(input.Registry, input.Repository, tag.ManifestDigest)
+		if err != nil {
+			return nil, fmt.Errorf("could not get labels of %s:%s: %w", input.Repository, tag.Tag, err)
+		}
+
+		if cleanup.HasRetentionLabels(labels) {
+			c.logger.Debug("image has retention labels",
+				"registry", input.Registry,
+				"repository", input.Repository,
+				"tag", tag.Tag,
+				"digest", tag.ManifestDigest,
+				"keep", labels[cleanup.LabelKeep],
+				"expires", labels[cleanup.LabelExpires],
+			)
+			result[tag.ManifestDigest] = labels
 		}
-		deletedTags = append(deletedTags, tag)
 	}
 
-	// Delete outdated branches
-	for _, tag := range deleteTags {
-		if !input.DryRun {
-			if err := c.deleteTag(input.Registry, input.Repository, tag.Tag); err != nil {
-				return deletedTags, fmt.Errorf("could not delete tag %s.%s:%s : %w", input.Registry, input.Repository, tag.Tag, err)
-			}
+	return result, nil
+}
+
+// policy returns the retention policy of the input with the pins of the repository.
+func (c *DigitalOceanClient) policy(input CleanupInput) (cleanup.Policy, error) {
+	var pins []cleanup.Pin
+	if c.pins != nil {
+		var err error
+		pins, err = c.pins(input.Registry, input.Repository)
+		if err != nil {
+			return cleanup.Policy{}, fmt.Errorf("could not load pins: %w", err)
 		}
-		deletedTags = append(deletedTags, tag)
 	}
 
-	return deletedTags, nil
+	policy := input.Policy
+	policy.Protected = c.protected
+	policy.Pins = pins
+	return policy, nil
+}
+
+// logPlan logs the decision about every tag of the plan.
+func (c *DigitalOceanClient) logPlan(plan *cleanup.Decisions) {
+	for _, tag := range plan.Tags {
+		decision := plan.ByTag[tag.Tag]
+		c.logger.Debug("classified tag",
+			"registry", plan.Registry,
+			"repository", plan.Repository,
+			"tag", tag.Tag,
+			"updated_at", tag.UpdatedAt,
+			"kind", decision.Kind,
+			"delete", decision.Delete,
+			"explanation", decision.Explanation,
+		)
+	}
+}
+
+// ExecutePlan deletes the planned tags from the registry, see cleanup.Executor.
+// Returns a list of deleted tags.
+func (c *DigitalOceanClient) ExecutePlan(plan *cleanup.Decisions, dryRun bool) ([]cleanup.Tag, error) {
+	executor := &cleanup.Executor{Deleter: c, Logger: c.logger}
+	return executor.Execute(plan, dryRun)
 }
 
-func (c *DigitalOceanClient) isProtected(tag string) bool {
-	for _, protectedTag := range c.protected {
-		if strings.EqualFold(protectedTag, tag) {
-			return true
+// ListTags returns all tags of the repository.
+func (c *DigitalOceanClient) ListTags(registry, repository string) ([]cleanup.Tag, error) {
+	var tags []cleanup.Tag
+	addr := fmt.Sprintf("/v2/registry/%s/repositories/%s/tags?per_page=%d", url.PathEscape(registry), url.PathEscape(repository), perPage)
+	for addr != "" {
+		var output = struct {
+			Tags []cleanup.Tag `json:"tags"`
+			pageLinks
+		}{}
+
+		if err := c.request(http.MethodGet, addr, nil, http.StatusOK, &output); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, output.Tags...)
+
+		var err error
+		if addr, err = output.next(addr); err != nil {
+			return nil, err
 		}
 	}
-	return false
+
+	return tags, nil
 }
 
-func (c *DigitalOceanClient) listTags(registry, repository string) ([]Tag, error) {
-	const addr = "https://api.digitalocean.com/v2/registry/%s/repositories/%s/tags"
+// pageLinks are the pagination links of a list response of the DigitalOcean API.
+type pageLinks struct {
+	Links struct {
+		Pages struct {
+			Next string `json:"next"`
+		} `json:"pages"`
+	} `json:"links"`
+}
+
+// next returns the path of the page after the current one, empty on the last page.
+func (l pageLinks) next(current string) (string, error) {
+	if l.Links.Pages.Next == "" {
+		return "", nil
+	}
 
-	req, err := http.NewRequest(
-		http.MethodGet,
-		fmt.Sprintf(addr, url.PathEscape(registry), url.PathEscape(repository)),
-		nil,
-	)
+	u, err := url.Parse(l.Links.Pages.Next)
 	if err != nil {
-		return nil, fmt.Errorf("could not create request: %w", err)
+		return "", fmt.Errorf("invalid next page link %q: %w", l.Links.Pages.Next, err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
-	req.Header.Set("User-Agent", "digitalocean-registry-cleaner")
+	next := u.RequestURI()
+	if next == current {
+		return "", fmt.Errorf("next page link %q points to the current page", l.Links.Pages.Next)
+	}
 
-	resp, err := c.client.Do(req)
+	return next, nil
+}
+
+// DeleteTag deletes the tag, the manifest stays in the registry until garbage collection.
+// The error wraps cleanup.ErrNotFound if the tag does not exist.
+func (c *DigitalOceanClient) DeleteTag(registry, repository, tag string) error {
+	addr := fmt.Sprintf("/v2/registry/%s/repositories/%s/tags/%s", url.PathEscape(registry), url.PathEscape(repository), url.PathEscape(tag))
+	err := c.request(http.MethodDelete, addr, nil, http.StatusNoContent, nil)
+	if IsNotFound(err) {
+		return fmt.Errorf("%w: %w", cleanup.ErrNotFound, err)
+	}
+	return err
+}
+
+// request calls the DigitalOcean API with input encoded as the JSON request body (if not nil)
+// and decodes the JSON response body into output (if not nil).
+// Rate limited and failed requests are retried, except for POST requests which are not idempotent.
+func (c *DigitalOceanClient) request(method, path string, input any, expectedStatus int, output any) error {
+	var data []byte
+	if input != nil {
+		var err error
+		data, err = json.Marshal(input)
+		if err != nil {
+			return fmt.Errorf("could not marshal request body: %w", err)
+		}
+	}
+
+	token, err := c.currentToken()
 	if err != nil {
-		return nil, fmt.Errorf("could not send request: %w", err)
+		return err
 	}
 
-	defer resp.Body.Close()
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		status, header, respBody, err := c.send(method, path, token, data)
+		latency := time.Since(start)
+
+		c.logger.Debug("api request",
+			"method", method,
+			"path", path,
+			"status", status,
+			"latency", latency,
+			"attempt", attempt,
+			"error", err,
+		)
+
+		if c.observer != nil {
+			c.observer(RequestEvent{
+				Method:  method,
+				Path:    path,
+				Status:  status,
+				Latency: latency,
+				Attempt: attempt,
+				Err:     err,
+			})
+		}
+
+		// transport errors are retried as well as rate limited and failed requests
+		retryable := err != nil
+		if err == nil && status != expectedStatus {
+			err = newAPIError(method, path, status, header, respBody)
+			retryable = IsRateLimited(err) || IsServerError(err)
+		}
+
+		if retryable && method != http.MethodPost && attempt <= c.maxRetries {
+			delay := c.retryDelay(attempt, header)
+			c.logger.Warn("retrying api request", "method", method, "path", path, "status", status, "attempt", attempt, "delay", delay, "error", err)
+			time.Sleep(delay)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if output == nil {
+			return nil
+		}
+
+		if err := json.Unmarshal(respBody, output); err != nil {
+			return fmt.Errorf("could not unmarshal response body: %w", err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil
 	}
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("could not read response body: %w", err)
+// currentToken returns the token of the token source if set.
+func (c *DigitalOceanClient) currentToken() (string, error) {
+	if c.tokens == nil {
+		return c.token, nil
 	}
 
-	var output = struct {
-		Tags []Tag `json:"tags"`
-	}{}
-	err = json.Unmarshal(body, &output)
+	token, err := c.tokens()
 	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal response body: %w", err)
+		return "", fmt.Errorf("could not get token: %w", err)
 	}
-
-	return output.Tags, nil
+	return token, nil
 }
 
-func (c *DigitalOceanClient) deleteTag(registry, repository, tag string) error {
-	const addr = "https://api.digitalocean.com/v2/registry/%s/repositories/%s/tags/%s"
+// send performs a single request and returns the status code, headers and body of the response.
+func (c *DigitalOceanClient) send(method, path, token string, data []byte) (int, http.Header, []byte, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
 
-	req, err := http.NewRequest(
-		http.MethodDelete,
-		fmt.Sprintf(addr, url.PathEscape(registry), url.PathEscape(repository), url.PathEscape(tag)),
-		nil,
-	)
+	req, err := http.NewRequest(method, apiURL+path, body)
 	if err != nil {
-		return fmt.Errorf("could not create request: %w", err)
+		return 0, nil, nil, fmt.Errorf("could not create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 	req.Header.Set("User-Agent", "digitalocean-registry-cleaner")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("could not send request: %w", err)
+		return 0, nil, nil, fmt.Errorf("could not send request: %w", err)
 	}
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, resp.Header, nil, fmt.Errorf("could not read response body: %w", err)
 	}
 
-	return nil
+	return resp.StatusCode, resp.Header, respBody, nil
+}
+
+// retryDelay honours the Retry-After header of rate limited responses, otherwise backs off exponentially.
+func (c *DigitalOceanClient) retryDelay(attempt int, header http.Header) time.Duration {
+	if header != nil {
+		if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, maxRetryDelay)
+		}
+	}
+	return min(c.backoff*time.Duration(1<<(attempt-1)), maxRetryDelay)
 }
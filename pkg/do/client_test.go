@@ -2,11 +2,22 @@ package do
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"digitalocean-registry-cleaner/pkg/cleanup"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,6 +39,154 @@ func (m *mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error)
 	return m.roundTripFunc(req)
 }
 
+// fakePageSize is the largest page served by fakeRegistry, smaller than per_page so that lists span pages
+const fakePageSize = 50
+
+// paginate returns the page of the items requested by the page and per_page query parameters
+// with the links of the DigitalOcean API pointing to the next page.
+func paginate[T any](req *http.Request, items []T) ([]T, map[string]map[string]string) {
+	page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+	page = max(page, 1)
+	perPage, _ := strconv.Atoi(req.URL.Query().Get("per_page"))
+	if perPage <= 0 {
+		perPage = 20
+	}
+	perPage = min(perPage, fakePageSize)
+
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	links := map[string]map[string]string{"pages": {}}
+	if end < len(items) {
+		next := *req.URL
+		query := next.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = query.Encode()
+		links["pages"]["next"] = apiURL + next.RequestURI()
+	}
+
+	return items[start:end], links
+}
+
+// fakeRegistry is an in-memory stand-in for the DigitalOcean registry API
+type fakeRegistry struct {
+	token    string // accepted token, any if empty
+	readOnly bool   // deletes are forbidden
+	// vanish are tags removed right after they were listed, as if deleted by an overlapping run
+	vanish       []string
+	tags         []cleanup.Tag
+	deleted      []string
+	deletes      []string // paths of the tag delete requests
+	registry     Registry
+	subscription Subscription
+	repositories []Repository
+	manifests    []Manifest
+	gcs          []GarbageCollection
+	gcType       string
+}
+
+func (f *fakeRegistry) RoundTrip(req *http.Request) (*http.Response, error) {
+	respond := func(status int, body string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+		}, nil
+	}
+
+	respondJSON := func(output any) (*http.Response, error) {
+		body, err := json.Marshal(output)
+		if err != nil {
+			return nil, err
+		}
+		return respond(http.StatusOK, string(body))
+	}
+
+	if f.token != "" && req.Header.Get("Authorization") != "Bearer "+f.token {
+		return respond(http.StatusUnauthorized, `{"id":"unauthorized","message":"Unable to authenticate you"}`)
+	}
+
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/v2/registry":
+		return respondJSON(map[string]Registry{"registry": f.registry})
+	case req.Method == http.MethodGet && req.URL.Path == "/v2/registry/subscription":
+		return respondJSON(map[string]Subscription{"subscription": f.subscription})
+	case req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/repositoriesV2"):
+		repositories, links := paginate(req, f.repositories)
+		return respondJSON(map[string]any{"repositories": repositories, "links": links})
+	case req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/digests"):
+		manifests, links := paginate(req, f.manifests)
+		return respondJSON(map[string]any{"manifests": manifests, "links": links})
+	case req.Method == http.MethodDelete && strings.Contains(req.URL.Path, "/digests/"):
+		digest := path.Base(req.URL.Path)
+		idx := slices.IndexFunc(f.manifests, func(manifest Manifest) bool { return manifest.Digest == digest })
+		if idx < 0 {
+			return respond(http.StatusNotFound, `{"id":"not_found","message":"manifest not found"}`)
+		}
+		f.manifests = slices.Delete(f.manifests, idx, idx+1)
+		return respond(http.StatusNoContent, "")
+	case req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/garbage-collections"):
+		return respondJSON(map[string][]GarbageCollection{"garbage_collections": f.gcs})
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/garbage-collection"):
+		var input struct {
+			Type string `json:"type"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&input); err != nil {
+			return respond(http.StatusBadRequest, `{"id":"bad_request","message":"invalid body"}`)
+		}
+		f.gcType = input.Type
+		gc := GarbageCollection{UUID: "gc-" + strconv.Itoa(len(f.gcs)+1), Status: "requested"}
+		f.gcs = append([]GarbageCollection{gc}, f.gcs...)
+		body, err := json.Marshal(map[string]GarbageCollection{"garbage_collection": gc})
+		if err != nil {
+			return nil, err
+		}
+		return respond(http.StatusCreated, string(body))
+	case req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/tags"):
+		tags, links := paginate(req, f.tags)
+		resp, err := respondJSON(map[string]any{"tags": tags, "links": links})
+		if links["pages"]["next"] == "" {
+			f.tags = slices.DeleteFunc(f.tags, func(tag cleanup.Tag) bool { return slices.Contains(f.vanish, tag.Tag) })
+		}
+		return resp, err
+	case req.Method == http.MethodDelete && f.readOnly:
+		f.deletes = append(f.deletes, req.URL.Path)
+		return respond(http.StatusForbidden, `{"id":"forbidden","message":"You are not authorized to perform this operation"}`)
+	case req.Method == http.MethodDelete:
+		f.deletes = append(f.deletes, req.URL.Path)
+		name := path.Base(req.URL.Path)
+		idx := slices.IndexFunc(f.tags, func(tag cleanup.Tag) bool { return tag.Tag == name })
+		if idx < 0 {
+			return respond(http.StatusNotFound, `{"id":"not_found","message":"tag not found"}`)
+		}
+		f.tags = slices.Delete(f.tags, idx, idx+1)
+		f.deleted = append(f.deleted, name)
+		return respond(http.StatusNoContent, "")
+	}
+
+	return respond(http.StatusNotFound, `{"id":"not_found","message":"unknown endpoint"}`)
+}
+
+func newFakeClient(protected []string, tags ...cleanup.Tag) (*DigitalOceanClient, *fakeRegistry) {
+	fake := &fakeRegistry{tags: tags}
+	client := NewClient("test-token", protected)
+	client.client = &http.Client{Transport: fake}
+	client.SetClock(func() time.Time { return testNow })
+	return client, fake
+}
+
+// testNow is the clock of fake clients
+var testNow = time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+
+func fakeTag(name string, age time.Duration) cleanup.Tag {
+	return cleanup.Tag{
+		Tag:            name,
+		ManifestDigest: "sha256:" + name,
+		CompressedSize: 100000,
+		Size:           200000,
+		UpdatedAt:      testNow.Add(-age),
+	}
+}
+
 func TestRunCleanup_DeleteOldBranches(t *testing.T) {
 	// Create a client with mocked HTTP transport
 	client := NewClient("test-token", []string{"prod-protected"})
@@ -37,34 +196,34 @@ func TestRunCleanup_DeleteOldBranches(t *testing.T) {
 	client.client = &http.Client{
 		Transport: &mockRoundTripper{
 			roundTripFunc: func(req *http.Request) (*http.Response, error) {
-				// Mock listTags response
+				// Mock ListTags response
 				if req.Method == http.MethodGet {
 					responseBody := `{
 						"tags": [
 							{
 								"tag": "prod-protected",
-								"manifest_digest": "sha256:test",
+								"manifest_digest": "sha256:prod-protected",
 								"compressed_size_bytes": 12345678,
 								"size_bytes": 12345678,
 								"updated_at": "` + now.Add(-40*24*time.Hour).Format(time.RFC3339) + `"
 							},
 							{
 								"tag": "tag-40-days-old",
-								"manifest_digest": "sha256:test",
+								"manifest_digest": "sha256:tag-40-days-old",
 								"compressed_size_bytes": 12345678,
 								"size_bytes": 12345678,
 								"updated_at": "` + now.Add(-40*24*time.Hour).Format(time.RFC3339) + `"
 							},
 							{
 								"tag": "tag-8-days-old",
-								"manifest_digest": "sha256:test",
+								"manifest_digest": "sha256:tag-8-days-old",
 								"compressed_size_bytes": 12345678,
 								"size_bytes": 12345678,
 								"updated_at": "` + now.Add(-8*24*time.Hour).Format(time.RFC3339) + `"
 							},
 							{
 								"tag": "tag-3-days-old",
-								"manifest_digest": "sha256:test",
+								"manifest_digest": "sha256:tag-3-days-old",
 								"compressed_size_bytes": 12345678,
 								"size_bytes": 12345678,
 								"updated_at": "` + now.Add(-3*24*time.Hour).Format(time.RFC3339) + `"
@@ -99,8 +258,10 @@ func TestRunCleanup_DeleteOldBranches(t *testing.T) {
 		Registry:   "test",
 		Repository: "test",
 		DryRun:     false,
-		KeepTags:   0,
-		MinAge:     7 * 24 * time.Hour, // 7 day
+		Policy: cleanup.Policy{
+			KeepTags: 0,
+			MinAge:   7 * 24 * time.Hour, // 7 day
+		},
 	}
 
 	deletedTags, err := client.RunCleanup(input)
@@ -186,8 +347,10 @@ func TestRunCleanup_KeepLatestNTags(t *testing.T) {
 		Registry:   "test",
 		Repository: "test",
 		DryRun:     false,
-		KeepTags:   3, // Keep only the latest 3 tags
-		MinAge:     0,
+		Policy: cleanup.Policy{
+			KeepTags: 3, // Keep only the latest 3 tags
+			MinAge:   0,
+		},
 	}
 
 	deletedTags, err := client.RunCleanup(input)
@@ -221,6 +384,13 @@ func TestRunCleanup_DryRun(t *testing.T) {
 								"compressed_size_bytes": 100000,
 								"size_bytes": 200000,
 								"updated_at": "2025-10-01T10:00:00Z"
+							},
+							{
+								"tag": "latest",
+								"manifest_digest": "sha256:def456",
+								"compressed_size_bytes": 100000,
+								"size_bytes": 200000,
+								"updated_at": "` + time.Now().Format(time.RFC3339) + `"
 							}
 						]
 					}`
@@ -249,8 +419,10 @@ func TestRunCleanup_DryRun(t *testing.T) {
 		Registry:   "test",
 		Repository: "test",
 		DryRun:     true, // Dry run mode
-		KeepTags:   0,
-		MinAge:     24 * time.Hour,
+		Policy: cleanup.Policy{
+			KeepTags: 0,
+			MinAge:   24 * time.Hour,
+		},
 	}
 
 	deletedTags, err := client.RunCleanup(input)
@@ -320,8 +492,10 @@ func TestRunCleanup_ProtectedTags(t *testing.T) {
 		Registry:   "test",
 		Repository: "test",
 		DryRun:     false,
-		KeepTags:   0,
-		MinAge:     24 * time.Hour,
+		Policy: cleanup.Policy{
+			KeepTags: 0,
+			MinAge:   24 * time.Hour,
+		},
 	}
 
 	deletedTags, err := client.RunCleanup(input)
@@ -397,8 +571,10 @@ func TestRunCleanup_MixedTagsAndBranches(t *testing.T) {
 		Registry:   "test",
 		Repository: "test",
 		DryRun:     false,
-		KeepTags:   2, // Keep only the latest 2 release tags
-		MinAge:     24 * time.Hour,
+		Policy: cleanup.Policy{
+			KeepTags: 2, // Keep only the latest 2 release tags
+			MinAge:   24 * time.Hour,
+		},
 	}
 
 	deletedTags, err := client.RunCleanup(input)
@@ -460,8 +636,10 @@ func TestRunCleanup_NoTagsToDelete(t *testing.T) {
 		Registry:   "test",
 		Repository: "test",
 		DryRun:     false,
-		KeepTags:   1,
-		MinAge:     24 * time.Hour,
+		Policy: cleanup.Policy{
+			KeepTags: 1,
+			MinAge:   24 * time.Hour,
+		},
 	}
 
 	deletedTags, err := client.RunCleanup(input)
@@ -470,3 +648,534 @@ func TestRunCleanup_NoTagsToDelete(t *testing.T) {
 	// All tags are recent, nothing should be deleted
 	assert.Equal(t, 0, len(deletedTags))
 }
+
+func TestRunCleanup_PullRequestsByAge(t *testing.T) {
+	const day = 24 * time.Hour
+	client, fake := newFakeClient([]string{"latest"},
+		fakeTag("latest", 90*day),
+		fakeTag("pr-1", 2*day),
+		fakeTag("pr-2", 20*day),
+		fakeTag("feature-x", 20*day),
+	)
+
+	deletedTags, err := client.RunCleanup(CleanupInput{
+		Registry:   "test",
+		Repository: "test",
+		Policy: cleanup.Policy{
+			MinAge:    30 * day,
+			PRPattern: regexp.MustCompile(`^pr-(\d+)$`),
+			PRMaxAge:  14 * day,
+		},
+	})
+
+	assert.NoError(t, err)
+	// pr-2 is older than PRMaxAge, feature-x is a branch younger than MinAge
+	assert.Equal(t, []string{"pr-2"}, cleanup.TagNames(deletedTags))
+	assert.Equal(t, []string{"pr-2"}, fake.deleted)
+}
+
+func TestRunCleanup_PullRequestsClosed(t *testing.T) {
+	const day = 24 * time.Hour
+	client, fake := newFakeClient([]string{},
+		fakeTag("pr-1", 1*day),
+		fakeTag("pr-2", 1*day),
+		fakeTag("pr-3", 20*day),
+		fakeTag("1.0.0", time.Hour),
+	)
+
+	deletedTags, err := client.RunCleanup(CleanupInput{
+		Registry:   "test",
+		Repository: "test",
+		Policy: cleanup.Policy{
+			MinAge:    30 * day,
+			PRPattern: regexp.MustCompile(`^pr-(\d+)$`),
+			PRMaxAge:  14 * day,
+			OpenPRs:   []int{1, 3},
+		},
+	})
+
+	assert.NoError(t, err)
+	// pr-2 is closed, pr-3 is still open but older than PRMaxAge
+	assert.ElementsMatch(t, []string{"pr-2", "pr-3"}, cleanup.TagNames(deletedTags))
+	assert.ElementsMatch(t, []string{"pr-2", "pr-3"}, fake.deleted)
+}
+
+func TestPlanCleanup_PullRequestReasons(t *testing.T) {
+	const day = 24 * time.Hour
+	client, _ := newFakeClient([]string{},
+		fakeTag("pr-2", 1*day),
+		fakeTag("pr-3", 20*day),
+		fakeTag("1.0.0", time.Hour),
+	)
+
+	plan, err := client.PlanCleanup(CleanupInput{
+		Registry:   "test",
+		Repository: "test",
+		Policy: cleanup.Policy{
+			MinAge:    30 * day,
+			PRPattern: regexp.MustCompile(`^pr-(\d+)$`),
+			PRMaxAge:  14 * day,
+			OpenPRs:   []int{3},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, cleanup.ReasonPRClosed, plan.Reasons["pr-2"])
+	assert.Equal(t, cleanup.ReasonPRAge, plan.Reasons["pr-3"])
+}
+
+func TestRunCleanup_PullRequestsNoneOpen(t *testing.T) {
+	const day = 24 * time.Hour
+	client, _ := newFakeClient([]string{},
+		fakeTag("pr-1", 1*day),
+		fakeTag("pr-2", 1*day),
+		fakeTag("1.0.0", time.Hour),
+	)
+
+	deletedTags, err := client.RunCleanup(CleanupInput{
+		Registry:   "test",
+		Repository: "test",
+		DryRun:     true,
+		Policy: cleanup.Policy{
+			MinAge:    30 * day,
+			PRPattern: regexp.MustCompile(`^pr-(\d+)$`),
+			OpenPRs:   []int{},
+		},
+	})
+
+	assert.NoError(t, err)
+	// an empty list means no pull request is open anymore
+	assert.ElementsMatch(t, []string{"pr-1", "pr-2"}, cleanup.TagNames(deletedTags))
+}
+
+func TestRunCleanup_PullRequestsDisabled(t *testing.T) {
+	const day = 24 * time.Hour
+	client, _ := newFakeClient([]string{},
+		fakeTag("pr-1", 1*day),
+		fakeTag("pr-2", 40*day),
+	)
+
+	deletedTags, err := client.RunCleanup(CleanupInput{
+		Registry:   "test",
+		Repository: "test",
+		Policy: cleanup.Policy{
+			MinAge:  30 * day,
+			OpenPRs: []int{},
+		},
+	})
+
+	assert.NoError(t, err)
+	// without a pattern pull request tags are treated as branches
+	assert.Equal(t, []string{"pr-2"}, cleanup.TagNames(deletedTags))
+}
+
+func TestRunCleanup_KeepNewestBranches(t *testing.T) {
+	const day = 24 * time.Hour
+	client, fake := newFakeClient([]string{"main"},
+		fakeTag("main", 1*day),
+		fakeTag("feature-1", 1*time.Hour),
+		fakeTag("feature-2", 2*time.Hour),
+		fakeTag("feature-3", 3*time.Hour),
+		fakeTag("feature-4", 4*time.Hour),
+		fakeTag("1.0.0", 5*day),
+	)
+
+	deletedTags, err := client.RunCleanup(CleanupInput{
+		Registry:   "test",
+		Repository: "test",
+		Policy: cleanup.Policy{
+			KeepTags:     5,
+			MinAge:       30 * day,
+			KeepBranches: 2,
+		},
+	})
+
+	assert.NoError(t, err)
+	// branches over the limit are deleted even if they are younger than the maximum age
+	assert.ElementsMatch(t, []string{"feature-3", "feature-4"}, cleanup.TagNames(deletedTags))
+	assert.ElementsMatch(t, []string{"feature-3", "feature-4"}, fake.deleted)
+
+	plan, err := client.PlanCleanup(CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: 30 * day, KeepBranches: 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, cleanup.ReasonBranchLimit, plan.Reasons["feature-2"])
+}
+
+func TestRunCleanup_MaxBranchAge(t *testing.T) {
+	const day = 24 * time.Hour
+	client, _ := newFakeClient([]string{},
+		fakeTag("feature-1", 1*day),
+		fakeTag("feature-2", 10*day),
+		fakeTag("feature-3", 20*day),
+		fakeTag("feature-4", 40*day),
+	)
+
+	deletedTags, err := client.RunCleanup(CleanupInput{
+		Registry:   "test",
+		Repository: "test",
+		DryRun:     true,
+		Policy: cleanup.Policy{
+			MinAge:       30 * day,
+			KeepBranches: 3,
+			MaxBranchAge: 7 * day,
+		},
+	})
+
+	assert.NoError(t, err)
+	// feature-2 and feature-3 are within the limit but older than the maximum age,
+	// feature-4 is both over the limit and too old
+	assert.ElementsMatch(t, []string{"feature-2", "feature-3", "feature-4"}, cleanup.TagNames(deletedTags))
+}
+
+func TestRequest_RetriesRateLimited(t *testing.T) {
+	client := NewClient("test-token", []string{})
+	client.backoff = 0
+
+	attempts := 0
+	client.client = &http.Client{
+		Transport: &mockRoundTripper{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				attempts++
+				if attempts < 3 {
+					header := make(http.Header)
+					header.Set("Retry-After", "0")
+					return &http.Response{
+						StatusCode: http.StatusTooManyRequests,
+						Body:       io.NopCloser(bytes.NewBufferString(`{"id":"too_many_requests"}`)),
+						Header:     header,
+					}, nil
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(bytes.NewBufferString(`{"tags":[]}`)),
+					Header:     make(http.Header),
+				}, nil
+			},
+		},
+	}
+
+	var events []RequestEvent
+	client.OnRequest(func(event RequestEvent) {
+		events = append(events, event)
+	})
+
+	tags, err := client.ListTags("test", "test")
+
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, events, 3)
+	assert.Equal(t, http.StatusTooManyRequests, events[0].Status)
+	assert.Equal(t, 3, events[2].Attempt)
+	assert.Equal(t, http.StatusOK, events[2].Status)
+}
+
+func TestRequest_GivesUpAfterRetries(t *testing.T) {
+	client := NewClient("test-token", []string{})
+	client.backoff = 0
+
+	attempts := 0
+	client.client = &http.Client{
+		Transport: &mockRoundTripper{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				attempts++
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Body:       io.NopCloser(bytes.NewBufferString("")),
+					Header:     make(http.Header),
+				}, nil
+			},
+		},
+	}
+
+	err := client.DeleteTag("test", "test", "old")
+	assert.Error(t, err)
+	assert.Equal(t, 1+defaultMaxRetries, attempts)
+
+	// POST requests are not idempotent and never retried
+	attempts = 0
+	_, err = client.StartGarbageCollection("test", "")
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestPlanCleanup_Protected(t *testing.T) {
+	client, _ := newFakeClient([]string{"latest", "main"},
+		fakeTag("latest", time.Hour),
+		fakeTag("Main", time.Hour),
+		fakeTag("feature", time.Hour),
+	)
+
+	plan, err := client.PlanCleanup(CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: time.Hour}})
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"latest", "Main"}, cleanup.TagNames(plan.Protected))
+}
+
+func TestRunCleanup_Logs(t *testing.T) {
+	client, _ := newFakeClient([]string{"latest"},
+		fakeTag("latest", 48*time.Hour),
+		fakeTag("feature", 48*time.Hour),
+		fakeTag("fresh", time.Hour),
+	)
+
+	var buf bytes.Buffer
+	client.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	_, err := client.RunCleanup(CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{KeepTags: 1, MinAge: 24 * time.Hour}})
+	assert.NoError(t, err)
+
+	decisions := map[string]bool{}
+	var requests, deletions int
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+
+		switch entry["msg"] {
+		case "classified tag":
+			decisions[entry["tag"].(string)] = entry["delete"].(bool)
+			assert.NotEmpty(t, entry["explanation"])
+		case "api request":
+			requests++
+			assert.Contains(t, entry, "latency")
+			assert.Contains(t, entry, "status")
+		case "deleted tag":
+			deletions++
+			assert.Equal(t, "feature", entry["tag"])
+			assert.Equal(t, string(cleanup.ReasonBranchAge), entry["reason"])
+		}
+	}
+
+	assert.Equal(t, map[string]bool{"latest": false, "feature": true, "fresh": false}, decisions)
+	assert.Equal(t, 2, requests) // list and delete
+	assert.Equal(t, 1, deletions)
+}
+
+func TestExecutePlan_AlreadyGone(t *testing.T) {
+	client, fake := newFakeClient(nil,
+		fakeTag("old-1", 72*time.Hour),
+		fakeTag("old-2", 48*time.Hour),
+		fakeTag("new", time.Hour),
+	)
+
+	plan, err := client.PlanCleanup(CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: 24 * time.Hour}})
+	assert.NoError(t, err)
+
+	// an overlapping run deletes a tag between planning and executing
+	fake.tags = slices.DeleteFunc(fake.tags, func(tag cleanup.Tag) bool { return tag.Tag == "old-1" })
+
+	deleted, err := client.ExecutePlan(plan, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old-2"}, cleanup.TagNames(deleted))
+	assert.Equal(t, []string{"old-1"}, cleanup.TagNames(plan.Gone))
+	assert.Equal(t, []string{"old-2"}, fake.deleted)
+}
+
+func TestRunCleanup_ListDeleteRace(t *testing.T) {
+	client, fake := newFakeClient(nil,
+		fakeTag("old-1", 72*time.Hour),
+		fakeTag("old-2", 48*time.Hour),
+		fakeTag("old-3", 36*time.Hour),
+		fakeTag("new", time.Hour),
+	)
+	fake.vanish = []string{"old-1", "old-3"}
+
+	deleted, err := client.RunCleanup(CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: 24 * time.Hour}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old-2"}, cleanup.TagNames(deleted))
+	assert.Equal(t, []string{"new"}, cleanup.TagNames(fake.tags))
+}
+
+func TestExecutePlan_RetriedDeleteAlreadyGone(t *testing.T) {
+	client, fake := newFakeClient(nil, fakeTag("old", 48*time.Hour), fakeTag("new", time.Hour))
+	client.backoff = 0
+
+	// the first delete succeeds but its response is lost, the retry finds the tag gone
+	deletes := 0
+	client.client = &http.Client{Transport: &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			resp, err := fake.RoundTrip(req)
+			if req.Method == http.MethodDelete {
+				deletes++
+				if deletes == 1 {
+					resp.StatusCode = http.StatusBadGateway
+				}
+			}
+			return resp, err
+		},
+	}}
+
+	plan, err := client.PlanCleanup(CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: 24 * time.Hour}})
+	assert.NoError(t, err)
+	deleted, err := client.ExecutePlan(plan, false)
+
+	assert.NoError(t, err)
+	assert.Empty(t, deleted)
+	assert.Equal(t, []string{"old"}, cleanup.TagNames(plan.Gone))
+	assert.Equal(t, 2, deletes)
+}
+
+func TestExecutePlan_DeleteErrorAborts(t *testing.T) {
+	client, fake := newFakeClient(nil, fakeTag("old", 48*time.Hour), fakeTag("new", time.Hour))
+
+	plan, err := client.PlanCleanup(CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: 24 * time.Hour}})
+	assert.NoError(t, err)
+
+	fake.readOnly = true
+	deleted, err := client.ExecutePlan(plan, false)
+
+	assert.True(t, IsForbidden(err))
+	assert.Empty(t, deleted)
+	assert.Empty(t, plan.Gone)
+}
+
+func TestRunCleanup_Guard(t *testing.T) {
+	client, fake := newFakeClient(nil,
+		fakeTag("feature-1", 48*time.Hour),
+		fakeTag("feature-2", 48*time.Hour),
+		fakeTag("feature-3", time.Hour),
+	)
+
+	input := CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{KeepTags: 1, MinAge: 24 * time.Hour, Guard: cleanup.Guard{MaxDeletePercent: 50}}}
+	deleted, err := client.RunCleanup(input)
+
+	assert.ErrorIs(t, err, cleanup.ErrSafetyLimit)
+	assert.EqualError(t, err, "refusing to delete 2 of 3 tags of test/test: exceeds the limit of 50% of the tags")
+	assert.Empty(t, deleted)
+	assert.Empty(t, fake.deleted)
+
+	input.Force = true
+	deleted, err = client.RunCleanup(input)
+
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 2)
+	assert.Len(t, fake.deleted, 2)
+}
+
+func TestPlanCleanup_Clock(t *testing.T) {
+	day := 24 * time.Hour
+	client, _ := newFakeClient(nil, fakeTag("feature-1", 25*day), fakeTag("feature-2", 10*day), fakeTag("main", day))
+	input := CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: 30 * day}}
+
+	plan, err := client.PlanCleanup(input)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Delete)
+
+	client.SetClock(func() time.Time { return testNow.Add(7 * day) })
+	plan, err = client.PlanCleanup(input)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"feature-1"}, cleanup.TagNames(plan.Delete))
+}
+
+func TestForecastCleanup(t *testing.T) {
+	day := 24 * time.Hour
+	client, _ := newFakeClient(nil, fakeTag("feature-1", 25*day), fakeTag("feature-2", 10*day), fakeTag("main", day))
+	input := CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: 30 * day}}
+
+	upcoming, err := client.ForecastCleanup(input, 14*day)
+	assert.NoError(t, err)
+	assert.Len(t, upcoming, 1)
+	assert.Equal(t, "feature-1", upcoming[0].Tag.Tag)
+	assert.Equal(t, testNow.Add(5*day), upcoming[0].At)
+	assert.Equal(t, cleanup.ReasonBranchAge, upcoming[0].Reason)
+}
+
+func TestPlanCleanup_Pins(t *testing.T) {
+	day := 24 * time.Hour
+	client, _ := newFakeClient(nil, fakeTag("feature-1", 45*day), fakeTag("feature-2", 40*day), fakeTag("main", day))
+	input := CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: 30 * day}}
+
+	client.SetPins(func(registry, repository string) ([]cleanup.Pin, error) {
+		assert.Equal(t, "test", registry)
+		assert.Equal(t, "test", repository)
+		return []cleanup.Pin{{Tag: "feature-1", Until: testNow.Add(day)}}, nil
+	})
+	plan, err := client.PlanCleanup(input)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"feature-2"}, cleanup.TagNames(plan.Delete))
+	assert.Equal(t, []string{"feature-1"}, cleanup.TagNames(plan.Pinned))
+
+	// nothing is deleted if the pins cannot be loaded
+	client.SetPins(func(registry, repository string) ([]cleanup.Pin, error) {
+		return nil, errors.New("access denied")
+	})
+	_, err = client.RunCleanup(input)
+	assert.ErrorContains(t, err, "could not load pins: access denied")
+}
+
+func TestPlanCleanup_Labels(t *testing.T) {
+	day := 24 * time.Hour
+	client, _ := newFakeClient(nil, fakeTag("feature-1", 45*day), fakeTag("feature-2", 40*day), fakeTag("feature-3", 10*day), fakeTag("main", day))
+	input := CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: 30 * day}}
+
+	var requested []string
+	client.SetLabels(func(registry, repository, digest string) (map[string]string, error) {
+		requested = append(requested, digest)
+		if digest == "sha256:feature-1" {
+			return map[string]string{cleanup.LabelKeep: "true"}, nil
+		}
+		return map[string]string{"maintainer": "platform"}, nil
+	})
+
+	plan, err := client.PlanCleanup(input)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"feature-2"}, cleanup.TagNames(plan.Delete))
+	assert.Equal(t, []string{"feature-1"}, cleanup.TagNames(plan.Labeled))
+	// only the images of tags about to be deleted are read
+	assert.ElementsMatch(t, []string{"sha256:feature-1", "sha256:feature-2"}, requested)
+
+	// nothing is deleted if the labels cannot be read
+	client.SetLabels(func(registry, repository, digest string) (map[string]string, error) {
+		return nil, errors.New("unexpected status code: 500")
+	})
+	_, err = client.RunCleanup(input)
+	assert.ErrorContains(t, err, "could not get labels of test:feature-")
+}
+
+func TestForecastCleanup_Labels(t *testing.T) {
+	day := 24 * time.Hour
+	client, _ := newFakeClient(nil, fakeTag("feature-1", 25*day), fakeTag("feature-2", 20*day), fakeTag("main", day))
+	input := CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{MinAge: 30 * day}}
+
+	client.SetLabels(func(registry, repository, digest string) (map[string]string, error) {
+		if digest == "sha256:feature-1" {
+			return map[string]string{cleanup.LabelExpires: "2026-10-30"}, nil
+		}
+		return map[string]string{cleanup.LabelKeep: "true"}, nil
+	})
+
+	upcoming, err := client.ForecastCleanup(input, 14*day)
+	assert.NoError(t, err)
+	assert.Len(t, upcoming, 1)
+	assert.Equal(t, "feature-1", upcoming[0].Tag.Tag)
+	assert.Equal(t, time.Date(2026, 10, 30, 0, 0, 0, 0, time.UTC), upcoming[0].At)
+}
+
+func TestListTags_Pages(t *testing.T) {
+	client, fake := newFakeClient([]string{})
+	for i := range 130 {
+		fake.tags = append(fake.tags, cleanup.Tag{Tag: fmt.Sprintf("tag-%d", i)})
+	}
+
+	tags, err := client.ListTags("my-registry", "backend")
+
+	assert.NoError(t, err)
+	assert.Len(t, tags, 130)
+	assert.Equal(t, "tag-0", tags[0].Tag)
+	assert.Equal(t, "tag-129", tags[129].Tag)
+}
+
+func TestListTags_NextPageLoop(t *testing.T) {
+	client := NewClient("test-token", nil)
+	client.client = &http.Client{Transport: &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			body := fmt.Sprintf(`{"tags":[{"tag":"a"}],"links":{"pages":{"next":"%s%s"}}}`, apiURL, req.URL.RequestURI())
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+		},
+	}}
+
+	_, err := client.ListTags("my-registry", "backend")
+
+	assert.ErrorContains(t, err, "points to the current page")
+}
@@ -0,0 +1,88 @@
+package do
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is an error response of the DigitalOcean API.
+type APIError struct {
+	Method     string `json:"-"`
+	Path       string `json:"-"`
+	StatusCode int    `json:"-"`
+	// ID identifies the kind of error, e.g. not_found or unauthorized.
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	// RequestID identifies the request for DigitalOcean support.
+	RequestID string `json:"request_id"`
+}
+
+// newAPIError creates an APIError from the response, the body is used if it is a DigitalOcean error body.
+func newAPIError(method, path string, status int, header http.Header, body []byte) *APIError {
+	apiErr := &APIError{}
+	_ = json.Unmarshal(body, apiErr)
+
+	apiErr.Method = method
+	apiErr.Path = path
+	apiErr.StatusCode = status
+	if apiErr.RequestID == "" && header != nil {
+		apiErr.RequestID = header.Get("X-Request-Id")
+	}
+
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	var details []string
+	if e.ID != "" {
+		details = append(details, e.ID)
+	}
+	if e.Message != "" {
+		details = append(details, e.Message)
+	}
+	if e.RequestID != "" {
+		details = append(details, "request id "+e.RequestID)
+	}
+
+	if len(details) == 0 {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status code: %d (%s)", e.StatusCode, strings.Join(details, ", "))
+}
+
+// statusCode returns the status code of an APIError in the chain, zero if there is none.
+func statusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether the API responded with 404 Not Found.
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsRateLimited reports whether the API responded with 429 Too Many Requests.
+func IsRateLimited(err error) bool {
+	return statusCode(err) == http.StatusTooManyRequests
+}
+
+// IsUnauthorized reports whether the API responded with 401 Unauthorized, the token is invalid or expired.
+func IsUnauthorized(err error) bool {
+	return statusCode(err) == http.StatusUnauthorized
+}
+
+// IsForbidden reports whether the API responded with 403 Forbidden, the token lacks a scope.
+func IsForbidden(err error) bool {
+	return statusCode(err) == http.StatusForbidden
+}
+
+// IsServerError reports whether the API responded with a 5xx status code.
+func IsServerError(err error) bool {
+	return statusCode(err) >= http.StatusInternalServerError
+}
@@ -0,0 +1,60 @@
+package do
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIError(t *testing.T) {
+	header := make(http.Header)
+	header.Set("X-Request-Id", "header-id")
+
+	err := newAPIError(http.MethodDelete, "/v2/registry", http.StatusNotFound, header,
+		[]byte(`{"id":"not_found","message":"tag not found","request_id":"body-id"}`))
+
+	assert.Equal(t, "not_found", err.ID)
+	assert.Equal(t, "tag not found", err.Message)
+	assert.Equal(t, "body-id", err.RequestID)
+	assert.EqualError(t, err, "unexpected status code: 404 (not_found, tag not found, request id body-id)")
+}
+
+func TestAPIError_RequestIDHeader(t *testing.T) {
+	header := make(http.Header)
+	header.Set("X-Request-Id", "header-id")
+
+	err := newAPIError(http.MethodGet, "/v2/registry", http.StatusBadGateway, header, []byte("<html>bad gateway</html>"))
+
+	assert.Equal(t, "header-id", err.RequestID)
+	assert.EqualError(t, err, "unexpected status code: 502 (request id header-id)")
+	assert.EqualError(t, newAPIError(http.MethodGet, "/", http.StatusBadGateway, nil, nil), "unexpected status code: 502")
+}
+
+func TestAPIError_Helpers(t *testing.T) {
+	wrap := func(status int) error {
+		return fmt.Errorf("could not list tags: %w", &APIError{StatusCode: status})
+	}
+
+	assert.True(t, IsNotFound(wrap(http.StatusNotFound)))
+	assert.True(t, IsRateLimited(wrap(http.StatusTooManyRequests)))
+	assert.True(t, IsUnauthorized(wrap(http.StatusUnauthorized)))
+	assert.True(t, IsForbidden(wrap(http.StatusForbidden)))
+	assert.True(t, IsServerError(wrap(http.StatusServiceUnavailable)))
+	assert.False(t, IsNotFound(wrap(http.StatusForbidden)))
+	assert.False(t, IsServerError(fmt.Errorf("connection refused")))
+}
+
+func TestDeleteTag_APIError(t *testing.T) {
+	client, _ := newFakeClient(nil, fakeTag("old", time.Hour))
+
+	err := client.DeleteTag("test", "test", "missing")
+
+	assert.True(t, IsNotFound(err))
+	var apiErr *APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "not_found", apiErr.ID)
+	assert.Equal(t, http.MethodDelete, apiErr.Method)
+}
@@ -0,0 +1,49 @@
+package do_test
+
+import (
+	"fmt"
+	"os"
+
+	"digitalocean-registry-cleaner/pkg/do"
+)
+
+func ExampleDigitalOceanClient_ListRepositories() {
+	client := do.NewClient(os.Getenv("DO_TOKEN"), nil)
+
+	repositories, err := client.ListRepositories("my-registry")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, repository := range repositories {
+		fmt.Printf("%s: %d tags, %d manifests\n", repository.Name, repository.TagCount, repository.ManifestCount)
+	}
+}
+
+func ExampleDigitalOceanClient_StartGarbageCollection() {
+	client := do.NewClient(os.Getenv("DO_TOKEN"), nil)
+
+	manifests, err := client.ListManifests("my-registry", "backend")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// delete untagged manifests, then release their blobs
+	for _, manifest := range manifests {
+		if len(manifest.Tags) == 0 {
+			if err := client.DeleteManifest("my-registry", "backend", manifest.Digest); err != nil && !do.IsNotFound(err) {
+				fmt.Println(err)
+				return
+			}
+		}
+	}
+
+	gc, err := client.StartGarbageCollection("my-registry", "unreferenced blobs only")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("started garbage collection", gc.UUID)
+}
@@ -0,0 +1,112 @@
+package do
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const tokensURL = "https://cloud.digitalocean.com/account/api/tokens"
+
+// Problem is an issue found by Preflight with a hint how to fix it.
+type Problem struct {
+	Subject string
+	Message string
+	Hint    string
+	// Err is the failed API request which prevented the check, nil if the API answered.
+	Err error
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s (%s)", p.Subject, p.Message, p.Hint)
+}
+
+// Preflight checks that the token is valid, the registry and its repositories exist and,
+// if write is set, that the token may delete tags. All problems found are returned.
+func (c *DigitalOceanClient) Preflight(registry string, repositories []string, write bool) []Problem {
+	reg, err := c.GetRegistry()
+	switch {
+	case err == nil:
+	case IsUnauthorized(err):
+		return []Problem{{Subject: "token", Message: "token is invalid or expired", Hint: "create a new token at " + tokensURL}}
+	case IsForbidden(err):
+		return []Problem{{Subject: "token", Message: "token is not allowed to read the registry", Hint: "grant the token the registry read and delete scopes at " + tokensURL}}
+	case IsNotFound(err):
+		return []Problem{{Subject: "registry", Message: "the account of the token has no container registry", Hint: "check the token belongs to the team owning registry " + registry}}
+	default:
+		return []Problem{{Subject: "api", Message: err.Error(), Hint: "check the connection to api.digitalocean.com or retry later", Err: err}}
+	}
+
+	if reg.Name != registry {
+		return []Problem{{
+			Subject: "registry",
+			Message: fmt.Sprintf("registry %s not found, the account of the token has registry %s", registry, reg.Name),
+			Hint:    "fix the registry name or use a token of the team owning the registry",
+		}}
+	}
+
+	existing, err := c.ListRepositories(registry)
+	if err != nil {
+		return []Problem{{Subject: "registry", Message: fmt.Sprintf("could not list repositories: %s", err), Hint: "retry later", Err: err}}
+	}
+
+	names := make([]string, 0, len(existing))
+	for _, repository := range existing {
+		names = append(names, repository.Name)
+	}
+
+	var problems []Problem
+	for _, repository := range repositories {
+		if !slices.Contains(names, repository) {
+			problems = append(problems, Problem{
+				Subject: "repository " + repository,
+				Message: fmt.Sprintf("repository not found in registry %s", registry),
+				Hint:    "existing repositories: " + summarize(names, 10),
+			})
+		}
+	}
+
+	if write {
+		if problem, ok := c.checkWrite(registry, repositories, names); !ok {
+			problems = append(problems, problem)
+		}
+	}
+
+	return problems
+}
+
+// checkWrite deletes a tag which does not exist from the first configured repository which exists, a read-only
+// token is refused with 403 instead of 404.
+func (c *DigitalOceanClient) checkWrite(registry string, repositories, existing []string) (Problem, bool) {
+	idx := slices.IndexFunc(repositories, func(repository string) bool { return slices.Contains(existing, repository) })
+	if idx < 0 {
+		return Problem{}, true // nothing to delete from
+	}
+
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+	tag := "dorc-preflight-" + hex.EncodeToString(suffix)
+
+	err := c.DeleteTag(registry, repositories[idx], tag)
+	switch {
+	case err == nil, IsNotFound(err):
+		return Problem{}, true
+	case IsForbidden(err), IsUnauthorized(err):
+		return Problem{Subject: "token", Message: "token is read-only and cannot delete tags", Hint: "grant the token the registry delete scope at " + tokensURL + " or use --dry-run"}, false
+	default:
+		return Problem{Subject: "token", Message: fmt.Sprintf("could not verify the delete scope: %s", err), Hint: "retry later", Err: err}, false
+	}
+}
+
+// summarize joins the first n names.
+func summarize(names []string, n int) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	if len(names) <= n {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:n], ", "), len(names)-n)
+}
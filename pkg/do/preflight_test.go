@@ -0,0 +1,83 @@
+package do
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPreflightClient() (*DigitalOceanClient, *fakeRegistry) {
+	client, fake := newFakeClient(nil)
+	fake.registry = Registry{Name: "my-registry"}
+	fake.repositories = []Repository{{Name: "backend"}, {Name: "frontend"}}
+	return client, fake
+}
+
+func TestPreflight(t *testing.T) {
+	client, fake := newPreflightClient()
+
+	assert.Empty(t, client.Preflight("my-registry", []string{"backend", "frontend"}, true))
+	assert.Empty(t, fake.deleted)
+}
+
+func TestPreflight_InvalidToken(t *testing.T) {
+	client, fake := newPreflightClient()
+	fake.token = "other"
+
+	problems := client.Preflight("my-registry", []string{"backend"}, true)
+
+	assert.Len(t, problems, 1)
+	assert.Equal(t, "token", problems[0].Subject)
+	assert.Equal(t, "token is invalid or expired", problems[0].Message)
+	assert.Contains(t, problems[0].Hint, tokensURL)
+}
+
+func TestPreflight_WrongRegistry(t *testing.T) {
+	client, _ := newPreflightClient()
+
+	problems := client.Preflight("other-registry", []string{"backend"}, false)
+
+	assert.Len(t, problems, 1)
+	assert.Equal(t, "registry other-registry not found, the account of the token has registry my-registry", problems[0].Message)
+}
+
+func TestPreflight_ReportsAllProblems(t *testing.T) {
+	client, fake := newPreflightClient()
+	fake.readOnly = true
+
+	problems := client.Preflight("my-registry", []string{"backend", "api", "worker"}, true)
+
+	assert.Len(t, problems, 3)
+	assert.Equal(t, "repository api", problems[0].Subject)
+	assert.Equal(t, "existing repositories: backend, frontend", problems[0].Hint)
+	assert.Equal(t, "repository worker", problems[1].Subject)
+	assert.Equal(t, "token is read-only and cannot delete tags", problems[2].Message)
+}
+
+func TestPreflight_ProbesConfiguredRepository(t *testing.T) {
+	client, fake := newPreflightClient()
+
+	assert.Empty(t, client.Preflight("my-registry", []string{"frontend"}, true))
+	assert.Len(t, fake.deletes, 1)
+	assert.Contains(t, fake.deletes[0], "/repositories/frontend/tags/dorc-preflight-")
+
+	// no configured repository exists, the missing ones are the problems
+	fake.deletes = nil
+	problems := client.Preflight("my-registry", []string{"api"}, true)
+	assert.Len(t, problems, 1)
+	assert.Equal(t, "repository api", problems[0].Subject)
+	assert.Empty(t, fake.deletes)
+}
+
+func TestPreflight_ReadOnlyDryRun(t *testing.T) {
+	client, fake := newPreflightClient()
+	fake.readOnly = true
+
+	assert.Empty(t, client.Preflight("my-registry", []string{"backend"}, false))
+}
+
+func TestSummarize(t *testing.T) {
+	assert.Equal(t, "none", summarize(nil, 3))
+	assert.Equal(t, "a, b", summarize([]string{"a", "b"}, 3))
+	assert.Equal(t, "a, b and 2 more", summarize([]string{"a", "b", "c", "d"}, 2))
+}
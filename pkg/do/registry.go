@@ -0,0 +1,191 @@
+package do
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type Registry struct {
+	Name                       string    `json:"name"`
+	Region                     string    `json:"region"`
+	StorageUsageBytes          int64     `json:"storage_usage_bytes"`
+	StorageUsageBytesUpdatedAt time.Time `json:"storage_usage_bytes_updated_at"`
+	CreatedAt                  time.Time `json:"created_at"`
+}
+
+type SubscriptionTier struct {
+	Name                 string `json:"name"`
+	Slug                 string `json:"slug"`
+	IncludedRepositories int    `json:"included_repositories"`
+	IncludedStorageBytes int64  `json:"included_storage_bytes"`
+	AllowStorageOverage  bool   `json:"allow_storage_overage"`
+}
+
+type Subscription struct {
+	Tier      SubscriptionTier `json:"tier"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// GetRegistry returns the registry of the account including its storage usage.
+func (c *DigitalOceanClient) GetRegistry() (*Registry, error) {
+	var output = struct {
+		Registry Registry `json:"registry"`
+	}{}
+
+	if err := c.request(http.MethodGet, "/v2/registry", nil, http.StatusOK, &output); err != nil {
+		return nil, err
+	}
+
+	return &output.Registry, nil
+}
+
+// GetSubscription returns the registry subscription of the account including the tier limits.
+func (c *DigitalOceanClient) GetSubscription() (*Subscription, error) {
+	var output = struct {
+		Subscription Subscription `json:"subscription"`
+	}{}
+
+	if err := c.request(http.MethodGet, "/v2/registry/subscription", nil, http.StatusOK, &output); err != nil {
+		return nil, err
+	}
+
+	return &output.Subscription, nil
+}
+
+type Manifest struct {
+	Digest         string    `json:"digest"`
+	CompressedSize int       `json:"compressed_size_bytes"`
+	Size           int       `json:"size_bytes"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Tags           []string  `json:"tags"`
+}
+
+type Repository struct {
+	RegistryName   string    `json:"registry_name"`
+	Name           string    `json:"name"`
+	LatestManifest *Manifest `json:"latest_manifest"`
+	TagCount       int       `json:"tag_count"`
+	ManifestCount  int       `json:"manifest_count"`
+}
+
+type GarbageCollection struct {
+	UUID         string    `json:"uuid"`
+	RegistryName string    `json:"registry_name"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	BlobsDeleted int       `json:"blobs_deleted"`
+	FreedBytes   int64     `json:"freed_bytes"`
+}
+
+// ListRepositories returns all repositories of the registry.
+func (c *DigitalOceanClient) ListRepositories(registry string) ([]Repository, error) {
+	var repositories []Repository
+	addr := fmt.Sprintf("/v2/registry/%s/repositoriesV2?per_page=%d", url.PathEscape(registry), perPage)
+	for addr != "" {
+		var output = struct {
+			Repositories []Repository `json:"repositories"`
+			pageLinks
+		}{}
+
+		if err := c.request(http.MethodGet, addr, nil, http.StatusOK, &output); err != nil {
+			return nil, err
+		}
+
+		repositories = append(repositories, output.Repositories...)
+
+		var err error
+		if addr, err = output.next(addr); err != nil {
+			return nil, err
+		}
+	}
+
+	return repositories, nil
+}
+
+// ListManifests returns all manifests of the repository with their tags, untagged manifests included.
+func (c *DigitalOceanClient) ListManifests(registry, repository string) ([]Manifest, error) {
+	var manifests []Manifest
+	addr := fmt.Sprintf("/v2/registry/%s/repositories/%s/digests?per_page=%d", url.PathEscape(registry), url.PathEscape(repository), perPage)
+	for addr != "" {
+		var output = struct {
+			Manifests []Manifest `json:"manifests"`
+			pageLinks
+		}{}
+
+		if err := c.request(http.MethodGet, addr, nil, http.StatusOK, &output); err != nil {
+			return nil, err
+		}
+
+		manifests = append(manifests, output.Manifests...)
+
+		var err error
+		if addr, err = output.next(addr); err != nil {
+			return nil, err
+		}
+	}
+
+	return manifests, nil
+}
+
+// DeleteManifest deletes the manifest and all of its tags, the blobs stay in the registry until garbage collection.
+func (c *DigitalOceanClient) DeleteManifest(registry, repository, digest string) error {
+	addr := fmt.Sprintf("/v2/registry/%s/repositories/%s/digests/%s", url.PathEscape(registry), url.PathEscape(repository), url.PathEscape(digest))
+	return c.request(http.MethodDelete, addr, nil, http.StatusNoContent, nil)
+}
+
+// LastGarbageCollection returns the most recent garbage collection of the registry or nil if there was none.
+func (c *DigitalOceanClient) LastGarbageCollection(registry string) (*GarbageCollection, error) {
+	var output = struct {
+		GarbageCollections []GarbageCollection `json:"garbage_collections"`
+	}{}
+
+	addr := fmt.Sprintf("/v2/registry/%s/garbage-collections?page=1&per_page=1", url.PathEscape(registry))
+	if err := c.request(http.MethodGet, addr, nil, http.StatusOK, &output); err != nil {
+		return nil, err
+	}
+
+	if len(output.GarbageCollections) == 0 {
+		return nil, nil
+	}
+
+	return &output.GarbageCollections[0], nil
+}
+
+// StartGarbageCollection starts garbage collection of the registry.
+// The type is one of "untagged manifests only", "unreferenced blobs only" or
+// "untagged manifests and unreferenced blobs"; empty uses the DigitalOcean default.
+func (c *DigitalOceanClient) StartGarbageCollection(registry, gcType string) (*GarbageCollection, error) {
+	var input = struct {
+		Type string `json:"type,omitempty"`
+	}{Type: gcType}
+
+	var output = struct {
+		GarbageCollection GarbageCollection `json:"garbage_collection"`
+	}{}
+
+	addr := fmt.Sprintf("/v2/registry/%s/garbage-collection", url.PathEscape(registry))
+	if err := c.request(http.MethodPost, addr, input, http.StatusCreated, &output); err != nil {
+		return nil, err
+	}
+
+	return &output.GarbageCollection, nil
+}
+
+// ValidateToken checks with a cheap authenticated call that the token is valid and allowed to read the registry.
+func (c *DigitalOceanClient) ValidateToken() error {
+	_, err := c.GetRegistry()
+	switch {
+	case err == nil, IsNotFound(err): // not found means the account has no registry yet
+		return nil
+	case IsUnauthorized(err):
+		return fmt.Errorf("token is invalid or expired: %w", err)
+	case IsForbidden(err):
+		return fmt.Errorf("token is not allowed to access the registry, it needs the registry scopes: %w", err)
+	default:
+		return err
+	}
+}
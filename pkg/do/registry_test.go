@@ -0,0 +1,168 @@
+package do
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRegistry(t *testing.T) {
+	client, fake := newFakeClient([]string{})
+	fake.registry = Registry{
+		Name:              "my-registry",
+		Region:            "fra1",
+		StorageUsageBytes: 1 << 30,
+	}
+
+	registry, err := client.GetRegistry()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "my-registry", registry.Name)
+	assert.Equal(t, "fra1", registry.Region)
+	assert.Equal(t, int64(1<<30), registry.StorageUsageBytes)
+}
+
+func TestGetSubscription(t *testing.T) {
+	client, fake := newFakeClient([]string{})
+	fake.subscription = Subscription{
+		Tier: SubscriptionTier{
+			Name:                 "Basic",
+			Slug:                 "basic",
+			IncludedRepositories: 5,
+			IncludedStorageBytes: 5 << 30,
+		},
+	}
+
+	subscription, err := client.GetSubscription()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "basic", subscription.Tier.Slug)
+	assert.Equal(t, 5, subscription.Tier.IncludedRepositories)
+	assert.Equal(t, int64(5<<30), subscription.Tier.IncludedStorageBytes)
+}
+
+func TestListRepositories(t *testing.T) {
+	client, fake := newFakeClient([]string{})
+	for i := range 150 {
+		fake.repositories = append(fake.repositories, Repository{
+			RegistryName: "my-registry",
+			Name:         fmt.Sprintf("repo-%d", i),
+			TagCount:     i,
+		})
+	}
+
+	repositories, err := client.ListRepositories("my-registry")
+
+	assert.NoError(t, err)
+	assert.Len(t, repositories, 150)
+	assert.Equal(t, "repo-0", repositories[0].Name)
+	assert.Equal(t, "repo-149", repositories[149].Name)
+}
+
+func TestListManifests(t *testing.T) {
+	client, fake := newFakeClient([]string{})
+	for i := range 120 {
+		fake.manifests = append(fake.manifests, Manifest{Digest: fmt.Sprintf("sha256:%d", i), Tags: []string{fmt.Sprintf("tag-%d", i)}})
+	}
+	fake.manifests = append(fake.manifests, Manifest{Digest: "sha256:untagged"})
+
+	manifests, err := client.ListManifests("my-registry", "backend")
+
+	assert.NoError(t, err)
+	assert.Len(t, manifests, 121)
+	assert.Equal(t, []string{"tag-0"}, manifests[0].Tags)
+	assert.Empty(t, manifests[120].Tags)
+}
+
+func TestDeleteManifest(t *testing.T) {
+	client, fake := newFakeClient([]string{})
+	fake.manifests = []Manifest{{Digest: "sha256:a"}, {Digest: "sha256:b"}}
+
+	assert.NoError(t, client.DeleteManifest("my-registry", "backend", "sha256:a"))
+	assert.Equal(t, []Manifest{{Digest: "sha256:b"}}, fake.manifests)
+	assert.True(t, IsNotFound(client.DeleteManifest("my-registry", "backend", "sha256:a")))
+}
+
+func TestDeleteTag_NotFound(t *testing.T) {
+	client, _ := newFakeClient([]string{})
+
+	err := client.DeleteTag("my-registry", "backend", "missing")
+
+	assert.ErrorIs(t, err, cleanup.ErrNotFound)
+	assert.True(t, IsNotFound(err))
+}
+
+func TestLastGarbageCollection(t *testing.T) {
+	client, fake := newFakeClient([]string{})
+
+	gc, err := client.LastGarbageCollection("my-registry")
+	assert.NoError(t, err)
+	assert.Nil(t, gc)
+
+	fake.gcs = []GarbageCollection{{UUID: "gc-1", Status: "succeeded", FreedBytes: 1024}}
+
+	gc, err = client.LastGarbageCollection("my-registry")
+	assert.NoError(t, err)
+	assert.Equal(t, "gc-1", gc.UUID)
+	assert.Equal(t, int64(1024), gc.FreedBytes)
+}
+
+func TestStartGarbageCollection(t *testing.T) {
+	client, fake := newFakeClient([]string{})
+
+	gc, err := client.StartGarbageCollection("my-registry", "untagged manifests and unreferenced blobs")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "gc-1", gc.UUID)
+	assert.Equal(t, "requested", gc.Status)
+	assert.Equal(t, "untagged manifests and unreferenced blobs", fake.gcType)
+}
+
+func TestValidateToken(t *testing.T) {
+	client, fake := newFakeClient(nil)
+	fake.token = "valid"
+
+	err := client.ValidateToken()
+	assert.True(t, IsUnauthorized(err))
+	assert.ErrorContains(t, err, "token is invalid or expired")
+
+	client.SetTokenSource(func() (string, error) { return "valid", nil })
+	assert.NoError(t, client.ValidateToken())
+
+	client.SetTokenSource(func() (string, error) { return "", errors.New("no token") })
+	assert.EqualError(t, client.ValidateToken(), "could not get token: no token")
+}
+
+func TestValidateToken_Forbidden(t *testing.T) {
+	client := NewClient("test-token", nil)
+	client.client = &http.Client{Transport: &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusForbidden, Body: io.NopCloser(strings.NewReader(`{"id":"forbidden"}`)), Header: make(http.Header)}, nil
+		},
+	}}
+
+	assert.ErrorContains(t, client.ValidateToken(), "not allowed to access the registry")
+}
+
+func TestTokenSource_Rotated(t *testing.T) {
+	client, fake := newFakeClient(nil, fakeTag("feature", time.Hour))
+	fake.token = "old"
+
+	token := "old"
+	client.SetTokenSource(func() (string, error) { return token, nil })
+
+	_, err := client.PlanCleanup(CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{KeepTags: 1, MinAge: time.Hour}})
+	assert.NoError(t, err)
+
+	fake.token, token = "new", "new"
+	_, err = client.PlanCleanup(CleanupInput{Registry: "test", Repository: "test", Policy: cleanup.Policy{KeepTags: 1, MinAge: time.Hour}})
+	assert.NoError(t, err)
+}
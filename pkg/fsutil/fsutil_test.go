@@ -0,0 +1,30 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	assert.NoError(t, WriteFile(path, []byte("first")))
+	assert.NoError(t, WriteFile(path, []byte("second")))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestWriteFile_MissingDirectory(t *testing.T) {
+	assert.Error(t, WriteFile(filepath.Join(t.TempDir(), "missing", "state.json"), []byte("content")))
+}
@@ -0,0 +1,157 @@
+package kube
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// serviceAccountDir is where Kubernetes mounts the service account of the pod.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+var (
+	// ErrNotFound is returned when the object does not exist.
+	ErrNotFound = errors.New("object not found")
+	// ErrConflict is returned when the object exists or was modified concurrently.
+	ErrConflict = errors.New("object was modified concurrently")
+)
+
+// Client is a minimal client of the Kubernetes API using the service account of the pod.
+type Client struct {
+	baseURL string
+	token   string
+	// Namespace is the namespace of the pod.
+	Namespace string
+	client    *http.Client
+}
+
+// NewInCluster creates a client from the service account mounted into the pod.
+func NewInCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST is not set")
+	}
+
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read service account token: %w", err)
+	}
+
+	namespace, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read service account namespace: %w", err)
+	}
+
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read service account CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("could not parse service account CA")
+	}
+
+	client := NewClient("https://"+net.JoinHostPort(host, port), strings.TrimSpace(string(token)), strings.TrimSpace(string(namespace)))
+	client.client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	return client, nil
+}
+
+// NewClient creates a client of the API server at baseURL authenticated by the bearer token.
+func NewClient(baseURL, token, namespace string) *Client {
+	return &Client{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		token:     token,
+		Namespace: namespace,
+		client:    http.DefaultClient,
+	}
+}
+
+// Get fetches the object at the API path, e.g. /api/v1/namespaces/default/configmaps/dorc.
+func (c *Client) Get(path string, output any) error {
+	return c.request(http.MethodGet, path, nil, output)
+}
+
+// Create creates the object in the collection at the API path, returns ErrConflict if it already exists.
+func (c *Client) Create(path string, input, output any) error {
+	return c.request(http.MethodPost, path, input, output)
+}
+
+// Update replaces the object at the API path, returns ErrConflict if its resourceVersion is outdated.
+func (c *Client) Update(path string, input, output any) error {
+	return c.request(http.MethodPut, path, input, output)
+}
+
+// Delete deletes the object at the API path.
+func (c *Client) Delete(path string) error {
+	return c.request(http.MethodDelete, path, nil, nil)
+}
+
+func (c *Client) request(method, path string, input, output any) error {
+	var body io.Reader
+	if input != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return fmt.Errorf("could not marshal request body: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "digitalocean-registry-cleaner")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("could not read response body: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, status(respBody))
+	}
+
+	if output != nil {
+		if err := json.Unmarshal(respBody, output); err != nil {
+			return fmt.Errorf("could not unmarshal response body: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// status returns the message of a Kubernetes Status response body.
+func status(body []byte) string {
+	var output struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &output); err != nil || output.Message == "" {
+		return strings.TrimSpace(string(body))
+	}
+	return output.Message
+}
@@ -0,0 +1,51 @@
+package kube
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL, "token", "dorc")
+}
+
+func TestClient(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"pins": "[]"}})
+		case http.MethodPost:
+			w.WriteHeader(http.StatusConflict)
+		case http.MethodPut:
+			w.WriteHeader(http.StatusNotFound)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"kind":"Status","message":"configmaps \"dorc\" is forbidden"}`))
+		}
+	})
+
+	var output struct {
+		Data map[string]string `json:"data"`
+	}
+	assert.NoError(t, client.Get("/api/v1/namespaces/dorc/configmaps/dorc", &output))
+	assert.Equal(t, "[]", output.Data["pins"])
+
+	assert.ErrorIs(t, client.Create("/api/v1/namespaces/dorc/configmaps", output, nil), ErrConflict)
+	assert.ErrorIs(t, client.Update("/api/v1/namespaces/dorc/configmaps/dorc", output, nil), ErrNotFound)
+	assert.EqualError(t, client.Delete("/api/v1/namespaces/dorc/configmaps/dorc"), `unexpected status code: 403: configmaps "dorc" is forbidden`)
+}
+
+func TestNewInCluster_OutsideCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	_, err := NewInCluster()
+	assert.ErrorContains(t, err, "not running in a Kubernetes cluster")
+}
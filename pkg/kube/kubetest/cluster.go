@@ -0,0 +1,104 @@
+// Package kubetest provides an in-memory Kubernetes API server for tests.
+package kubetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Cluster is an in-memory stand-in for the Kubernetes API. Objects are created by POST to their collection,
+// fetched by GET and replaced by PUT only if their resourceVersion is current, like the API server does.
+type Cluster struct {
+	mu      sync.Mutex
+	version int
+	objects map[string]map[string]any // by API path
+}
+
+// NewServer starts a server of an empty cluster, it is closed when the test finishes.
+func NewServer(t testing.TB) (*httptest.Server, *Cluster) {
+	cluster := &Cluster{objects: map[string]map[string]any{}}
+	server := httptest.NewServer(cluster)
+	t.Cleanup(server.Close)
+
+	return server, cluster
+}
+
+// Object returns the object at the API path, e.g. /api/v1/namespaces/dorc/configmaps/dorc-pins, nil if it does not exist.
+func (c *Cluster) Object(path string) map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.objects[path]
+}
+
+// Store stores the object at the API path with a new resource version.
+func (c *Cluster) Store(path string, object map[string]any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store(path, object)
+}
+
+func (c *Cluster) store(path string, object map[string]any) {
+	c.version++
+	metadata, ok := object["metadata"].(map[string]any)
+	if !ok {
+		metadata = map[string]any{}
+		object["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = strconv.Itoa(c.version)
+	c.objects[path] = object
+}
+
+func (c *Cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	input := map[string]any{}
+	if r.Body != nil {
+		_ = json.NewDecoder(r.Body).Decode(&input)
+	}
+	metadata, _ := input["metadata"].(map[string]any)
+	current, exists := c.objects[r.URL.Path]
+
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(current)
+	case http.MethodPost:
+		name, _ := metadata["name"].(string)
+		if name == "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		path := strings.TrimSuffix(r.URL.Path, "/") + "/" + name
+		if _, ok := c.objects[path]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		c.store(path, input)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(input)
+	case http.MethodPut:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if metadata["resourceVersion"] != current["metadata"].(map[string]any)["resourceVersion"] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		c.store(r.URL.Path, input)
+		_ = json.NewEncoder(w).Encode(input)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,541 @@
+package lock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/kube"
+	"digitalocean-registry-cleaner/pkg/s3"
+)
+
+// ErrLocked is returned when another run holds the lock.
+var ErrLocked = errors.New("run lock is held")
+
+// Lock prevents overlapping cleanup runs, also across hosts and clusters sharing a registry.
+type Lock interface {
+	// Acquire takes the lock, returns ErrLocked if another run holds it and it is not stale.
+	Acquire() error
+	// Renew marks the lock as still held, so that it does not become stale while the run is in progress.
+	// Returns ErrLocked if another run took the lock over.
+	Renew() error
+	// Release gives up the lock if it is still held by this run.
+	Release() error
+}
+
+// Config configures the lock.
+type Config struct {
+	// Holder identifies the run, e.g. hostname, process ID and run ID.
+	Holder string
+	// StaleAfter is the time since the lock was acquired or renewed after which it is taken over,
+	// as its holder probably crashed. Zero never takes over.
+	StaleAfter time.Duration
+	// S3 configures the S3-compatible storage used by s3:// locks.
+	S3 s3.Config
+}
+
+// Holder describes the run holding a lock.
+type Holder struct {
+	ID         string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at,omitzero"`
+}
+
+// stale reports whether the lock can be taken over at the time now.
+func (h Holder) stale(now time.Time, staleAfter time.Duration) bool {
+	seen := h.AcquiredAt
+	if h.RenewedAt.After(seen) {
+		seen = h.RenewedAt
+	}
+	return staleAfter > 0 && now.Sub(seen) > staleAfter
+}
+
+// lostError describes the holder which took the lock over.
+func lostError(holder Holder) error {
+	return fmt.Errorf("run lock was taken over: %w", lockedError(holder))
+}
+
+// Open returns the lock for the target:
+//   - "lease://namespace/name" is a Kubernetes Lease, the namespace defaults to the namespace of the pod
+//   - "s3://bucket/key" is an object in an S3-compatible bucket created with conditional writes
+//   - anything else is a path of a local lock file
+func Open(target string, config Config) (Lock, error) {
+	if config.Holder == "" {
+		return nil, fmt.Errorf("lock holder is required")
+	}
+
+	switch {
+	case strings.HasPrefix(target, "lease://"):
+		client, err := kube.NewInCluster()
+		if err != nil {
+			return nil, fmt.Errorf("could not create Kubernetes client: %w", err)
+		}
+
+		namespace, name, found := strings.Cut(strings.TrimPrefix(target, "lease://"), "/")
+		if !found {
+			namespace, name = client.Namespace, namespace
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid lock target %q: lease name is missing", target)
+		}
+
+		return &leaseLock{client: client, namespace: namespace, name: name, config: config, now: time.Now}, nil
+	case strings.HasPrefix(target, "s3://"):
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(target, "s3://"), "/")
+		if bucket == "" || key == "" {
+			return nil, fmt.Errorf("invalid lock target %q: bucket or key is missing", target)
+		}
+
+		client, err := s3.New(config.S3)
+		if err != nil {
+			return nil, fmt.Errorf("could not create S3 client: %w", err)
+		}
+
+		return &s3Lock{client: client, bucket: bucket, key: key, config: config, now: time.Now}, nil
+	default:
+		return &fileLock{path: strings.TrimPrefix(target, "file://"), config: config, now: time.Now}, nil
+	}
+}
+
+// lockedError describes the holder of the lock.
+func lockedError(holder Holder) error {
+	return fmt.Errorf("%w by %s since %s", ErrLocked, holder.ID, holder.AcquiredAt.Format(time.RFC3339))
+}
+
+// fileLock is a lock file created exclusively, it protects runs on a single host or a shared volume.
+// The file is written completely before it is linked to its path, so it always has a holder.
+type fileLock struct {
+	path   string
+	config Config
+	now    func() time.Time
+}
+
+func (l *fileLock) Acquire() error {
+	holder := Holder{ID: l.config.Holder, AcquiredAt: l.now().UTC()}
+	content, err := json.Marshal(holder)
+	if err != nil {
+		return fmt.Errorf("could not marshal lock: %w", err)
+	}
+
+	tmp, err := l.temp()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return fmt.Errorf("could not write lock file: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		// linking fails if the lock file exists, so only one run creates it
+		err := os.Link(tmp, l.path)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("could not create lock file: %w", err)
+		}
+
+		seen, current, err := l.read(l.path)
+		if err != nil {
+			return err
+		}
+		if attempt > 1 || !current.stale(l.now(), l.config.StaleAfter) {
+			return lockedError(current)
+		}
+
+		// the holder probably crashed, take the lock over
+		if err := l.removeStale(seen); err != nil {
+			return err
+		}
+	}
+}
+
+// removeStale removes the lock file if it still has the stale content. The file is moved aside first
+// and checked afterwards: of several runs taking over the same stale lock, only the first one removes it
+// and the others move the new lock file of that run back.
+func (l *fileLock) removeStale(seen []byte) error {
+	aside, err := l.temp()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(aside)
+
+	if err := os.Rename(l.path, aside); errors.Is(err, fs.ErrNotExist) {
+		return nil // released meanwhile
+	} else if err != nil {
+		return fmt.Errorf("could not remove stale lock file: %w", err)
+	}
+
+	content, holder, err := l.read(aside)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(content, seen) {
+		return nil
+	}
+
+	// another run took the lock over meanwhile
+	if err := os.Link(aside, l.path); err != nil {
+		return fmt.Errorf("could not restore lock file of %s: %w", holder.ID, err)
+	}
+	return lockedError(holder)
+}
+
+// temp returns a new empty file next to the lock file.
+func (l *fileLock) temp() (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return "", fmt.Errorf("could not create lock file: %w", err)
+	}
+	return file.Name(), file.Close()
+}
+
+func (l *fileLock) Renew() error {
+	_, current, err := l.read(l.path)
+	if err != nil {
+		return err
+	}
+	if current.ID != l.config.Holder {
+		return lostError(current)
+	}
+
+	current.RenewedAt = l.now().UTC()
+	content, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("could not marshal lock: %w", err)
+	}
+
+	tmp, err := l.temp()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return fmt.Errorf("could not write lock file: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("could not renew lock file: %w", err)
+	}
+
+	return nil
+}
+
+// Release moves the lock file aside before checking its holder, so that a lock taken over meanwhile is moved back
+// instead of being removed.
+func (l *fileLock) Release() error {
+	aside, err := l.temp()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(aside)
+
+	if err := os.Rename(l.path, aside); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not remove lock file: %w", err)
+	}
+
+	_, current, err := l.read(aside)
+	if err != nil {
+		return err
+	}
+	if current.ID == l.config.Holder {
+		return nil
+	}
+
+	// taken over by another run
+	if err := os.Link(aside, l.path); err != nil {
+		return fmt.Errorf("could not restore lock file of %s: %w", current.ID, err)
+	}
+	return nil
+}
+
+// read returns the content and the holder of the lock file, a file without a holder was created by a crashed run
+// of an older version.
+func (l *fileLock) read(path string) ([]byte, Holder, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, Holder{}, fmt.Errorf("could not read lock file: %w", err)
+	}
+
+	var holder Holder
+	if err := json.Unmarshal(content, &holder); err != nil {
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			return nil, Holder{}, fmt.Errorf("could not read lock file: %w", statErr)
+		}
+		return content, Holder{ID: "unknown", AcquiredAt: info.ModTime()}, nil
+	}
+
+	return content, holder, nil
+}
+
+// s3Lock is an object created with conditional writes (If-None-Match).
+type s3Lock struct {
+	client *s3.Client
+	bucket string
+	key    string
+	config Config
+	now    func() time.Time
+}
+
+func (l *s3Lock) Acquire() error {
+	holder := Holder{ID: l.config.Holder, AcquiredAt: l.now().UTC()}
+	content, err := json.Marshal(holder)
+	if err != nil {
+		return fmt.Errorf("could not marshal lock: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := l.client.PutObjectIf(l.bucket, l.key, content, "application/json", s3.Condition{IfNoneMatch: "*"})
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, s3.ErrPreconditionFailed) {
+			return fmt.Errorf("could not create lock object: %w", err)
+		}
+
+		body, etag, err := l.client.GetObjectETag(l.bucket, l.key)
+		if errors.Is(err, s3.ErrNotFound) && attempt == 1 {
+			continue // released meanwhile
+		}
+		if err != nil {
+			return fmt.Errorf("could not read lock object: %w", err)
+		}
+
+		var current Holder
+		if err := json.Unmarshal(body, &current); err != nil {
+			return fmt.Errorf("could not unmarshal lock object: %w", err)
+		}
+		if !current.stale(l.now(), l.config.StaleAfter) {
+			return lockedError(current)
+		}
+
+		// the holder probably crashed, take the lock over unless another run was faster
+		err = l.client.PutObjectIf(l.bucket, l.key, content, "application/json", s3.Condition{IfMatch: etag})
+		if errors.Is(err, s3.ErrPreconditionFailed) {
+			return fmt.Errorf("%w by another run", ErrLocked)
+		}
+		if err != nil {
+			return fmt.Errorf("could not take over stale lock object: %w", err)
+		}
+		return nil
+	}
+}
+
+func (l *s3Lock) Renew() error {
+	current, etag, err := l.read()
+	if err != nil {
+		return err
+	}
+	if current.ID != l.config.Holder {
+		return lostError(current)
+	}
+
+	current.RenewedAt = l.now().UTC()
+	content, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("could not marshal lock: %w", err)
+	}
+
+	err = l.client.PutObjectIf(l.bucket, l.key, content, "application/json", s3.Condition{IfMatch: etag})
+	if errors.Is(err, s3.ErrPreconditionFailed) {
+		return fmt.Errorf("run lock was taken over: %w by another run", ErrLocked)
+	}
+	if err != nil {
+		return fmt.Errorf("could not renew lock object: %w", err)
+	}
+
+	return nil
+}
+
+// Release deletes the lock object only if it was not changed since its holder was checked.
+func (l *s3Lock) Release() error {
+	current, etag, err := l.read()
+	if errors.Is(err, s3.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.ID != l.config.Holder {
+		return nil // taken over by another run
+	}
+
+	err = l.client.DeleteObjectIf(l.bucket, l.key, s3.Condition{IfMatch: etag})
+	if errors.Is(err, s3.ErrPreconditionFailed) {
+		return nil // taken over by another run meanwhile
+	}
+	if err != nil {
+		return fmt.Errorf("could not delete lock object: %w", err)
+	}
+
+	return nil
+}
+
+// read returns the holder of the lock object and its ETag.
+func (l *s3Lock) read() (Holder, string, error) {
+	body, etag, err := l.client.GetObjectETag(l.bucket, l.key)
+	if err != nil {
+		return Holder{}, "", fmt.Errorf("could not read lock object: %w", err)
+	}
+
+	var current Holder
+	if err := json.Unmarshal(body, &current); err != nil {
+		return Holder{}, "", fmt.Errorf("could not unmarshal lock object: %w", err)
+	}
+	return current, etag, nil
+}
+
+// lease is a coordination.k8s.io/v1 Lease. It is kept as read, so that labels, annotations and other fields
+// set by someone else survive the updates of its holder.
+type lease map[string]any
+
+// spec returns the spec of the lease, it is added if missing.
+func (le lease) spec() map[string]any {
+	spec, ok := le["spec"].(map[string]any)
+	if !ok {
+		spec = map[string]any{}
+		le["spec"] = spec
+	}
+	return spec
+}
+
+// holder returns the holder of the lease, the ID is empty if the lease is released.
+func (le lease) holder() Holder {
+	spec := le.spec()
+	id, _ := spec["holderIdentity"].(string)
+	acquireTime, _ := spec["acquireTime"].(string)
+	renewTime, _ := spec["renewTime"].(string)
+	acquiredAt, _ := time.Parse(time.RFC3339, acquireTime)
+	renewedAt, _ := time.Parse(time.RFC3339, renewTime)
+	return Holder{ID: id, AcquiredAt: acquiredAt, RenewedAt: renewedAt}
+}
+
+// microTime is the format of the times of a Lease.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// leaseLock is a Kubernetes Lease.
+// The API server rejects updates of outdated leases, so only one run can take over a released or stale lease.
+type leaseLock struct {
+	client    *kube.Client
+	namespace string
+	name      string
+	config    Config
+	now       func() time.Time
+}
+
+func (l *leaseLock) path() string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", l.namespace)
+}
+
+func (l *leaseLock) Acquire() error {
+	current := lease{}
+	err := l.client.Get(l.path()+"/"+l.name, &current)
+	if errors.Is(err, kube.ErrNotFound) {
+		current = lease{
+			"apiVersion": "coordination.k8s.io/v1",
+			"kind":       "Lease",
+			"metadata":   map[string]any{"name": l.name, "namespace": l.namespace},
+		}
+		l.hold(current)
+
+		err := l.client.Create(l.path(), current, nil)
+		if errors.Is(err, kube.ErrConflict) {
+			return fmt.Errorf("%w by another run", ErrLocked)
+		}
+		if err != nil {
+			return fmt.Errorf("could not create lease: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not get lease: %w", err)
+	}
+
+	if holder := current.holder(); holder.ID != "" && !holder.stale(l.now(), l.config.StaleAfter) {
+		return lockedError(holder)
+	}
+
+	// released or stale, the resource version makes sure no other run took it meanwhile
+	l.hold(current)
+	err = l.client.Update(l.path()+"/"+l.name, current, nil)
+	if errors.Is(err, kube.ErrConflict) {
+		return fmt.Errorf("%w by another run", ErrLocked)
+	}
+	if err != nil {
+		return fmt.Errorf("could not update lease: %w", err)
+	}
+
+	return nil
+}
+
+func (l *leaseLock) Renew() error {
+	current := lease{}
+	if err := l.client.Get(l.path()+"/"+l.name, &current); err != nil {
+		return fmt.Errorf("could not get lease: %w", err)
+	}
+
+	if holder := current.holder(); holder.ID != l.config.Holder {
+		return lostError(holder)
+	}
+
+	current.spec()["renewTime"] = l.now().UTC().Format(microTime)
+	err := l.client.Update(l.path()+"/"+l.name, current, nil)
+	if errors.Is(err, kube.ErrConflict) {
+		return fmt.Errorf("run lock was taken over: %w by another run", ErrLocked)
+	}
+	if err != nil {
+		return fmt.Errorf("could not renew lease: %w", err)
+	}
+
+	return nil
+}
+
+func (l *leaseLock) Release() error {
+	current := lease{}
+	err := l.client.Get(l.path()+"/"+l.name, &current)
+	if errors.Is(err, kube.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not get lease: %w", err)
+	}
+
+	if current.holder().ID != l.config.Holder {
+		return nil // taken over by another run
+	}
+
+	spec := current.spec()
+	delete(spec, "holderIdentity")
+	delete(spec, "acquireTime")
+	delete(spec, "renewTime")
+	if err := l.client.Update(l.path()+"/"+l.name, current, nil); err != nil {
+		return fmt.Errorf("could not release lease: %w", err)
+	}
+
+	return nil
+}
+
+// hold sets this run as the holder of the lease, other fields are kept.
+func (l *leaseLock) hold(current lease) {
+	now := l.now().UTC().Format(microTime)
+	spec := current.spec()
+	spec["holderIdentity"] = l.config.Holder
+	spec["acquireTime"] = now
+	spec["renewTime"] = now
+	if seconds := int(l.config.StaleAfter.Seconds()); seconds > 0 {
+		spec["leaseDurationSeconds"] = seconds
+	} else {
+		delete(spec, "leaseDurationSeconds")
+	}
+}
@@ -0,0 +1,232 @@
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/kube"
+	"digitalocean-registry-cleaner/pkg/kube/kubetest"
+	"digitalocean-registry-cleaner/pkg/s3"
+	"digitalocean-registry-cleaner/pkg/s3/s3test"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+
+// clock returns a time which is moved by the test
+func clock() (func() time.Time, *time.Time) {
+	now := start
+	return func() time.Time { return now }, &now
+}
+
+// testLocks returns a lock of every backend for each holder, sharing the same clock
+func testLocks(t *testing.T, holders ...string) map[string][]Lock {
+	now, _ := clock()
+	return testLocksAt(t, now, holders...)
+}
+
+func testLocksAt(t *testing.T, now func() time.Time, holders ...string) map[string][]Lock {
+	path := filepath.Join(t.TempDir(), "dorc.lock")
+
+	storage, _ := s3test.NewServer(t)
+	cluster, _ := kubetest.NewServer(t)
+	client := kube.NewClient(cluster.URL, "token", "dorc")
+
+	locks := map[string][]Lock{}
+	for _, holder := range holders {
+		config := Config{Holder: holder, StaleAfter: time.Hour, S3: s3.Config{Endpoint: storage.URL, AccessKey: s3test.AccessKey, SecretKey: s3test.SecretKey}}
+
+		file, err := Open(path, config)
+		assert.NoError(t, err)
+		file.(*fileLock).now = now
+
+		object, err := Open("s3://bucket/dorc.lock", config)
+		assert.NoError(t, err)
+		object.(*s3Lock).now = now
+
+		locks["file"] = append(locks["file"], file)
+		locks["s3"] = append(locks["s3"], object)
+		locks["lease"] = append(locks["lease"], &leaseLock{client: client, namespace: "dorc", name: "dorc", config: config, now: now})
+	}
+
+	return locks
+}
+
+func TestLock(t *testing.T) {
+	for backend, locks := range testLocks(t, "staging", "prod") {
+		t.Run(backend, func(t *testing.T) {
+			staging, prod := locks[0], locks[1]
+
+			assert.NoError(t, staging.Acquire())
+
+			err := prod.Acquire()
+			assert.ErrorIs(t, err, ErrLocked)
+			assert.ErrorContains(t, err, "run lock is held by staging since 2026-10-18T02:00:00Z")
+
+			// releasing a lock held by another run keeps it
+			assert.NoError(t, prod.Release())
+			assert.ErrorIs(t, prod.Acquire(), ErrLocked)
+
+			assert.NoError(t, staging.Release())
+			assert.NoError(t, prod.Acquire())
+			assert.NoError(t, prod.Release())
+			assert.NoError(t, prod.Release())
+		})
+	}
+}
+
+func TestLock_Renew(t *testing.T) {
+	now, moved := clock()
+	for backend, locks := range testLocksAt(t, now, "long", "next") {
+		t.Run(backend, func(t *testing.T) {
+			*moved = start
+			long, next := locks[0], locks[1]
+
+			assert.NoError(t, long.Acquire())
+
+			// a run renewing the lock keeps it beyond the stale time
+			*moved = start.Add(50 * time.Minute)
+			assert.NoError(t, long.Renew())
+			*moved = start.Add(100 * time.Minute)
+			assert.ErrorIs(t, next.Acquire(), ErrLocked)
+
+			// a run which stopped renewing loses it
+			*moved = start.Add(151 * time.Minute)
+			assert.NoError(t, next.Acquire())
+			err := long.Renew()
+			assert.ErrorIs(t, err, ErrLocked)
+			assert.ErrorContains(t, err, "run lock was taken over")
+
+			assert.NoError(t, long.Release())
+			assert.ErrorIs(t, long.Acquire(), ErrLocked)
+			assert.NoError(t, next.Release())
+		})
+	}
+}
+
+func TestLock_Stale(t *testing.T) {
+	now, moved := clock()
+	for backend, locks := range testLocksAt(t, now, "crashed", "next") {
+		t.Run(backend, func(t *testing.T) {
+			*moved = start
+			crashed, next := locks[0], locks[1]
+
+			assert.NoError(t, crashed.Acquire())
+
+			*moved = start.Add(59 * time.Minute)
+			assert.ErrorIs(t, next.Acquire(), ErrLocked)
+
+			*moved = start.Add(61 * time.Minute)
+			assert.NoError(t, next.Acquire())
+
+			// the crashed run must not release the lock it lost
+			assert.NoError(t, crashed.Release())
+			assert.ErrorIs(t, crashed.Acquire(), ErrLocked)
+			assert.NoError(t, next.Release())
+		})
+	}
+}
+
+func TestFileLock_Corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dorc.lock")
+	assert.NoError(t, os.WriteFile(path, nil, 0o644))
+
+	l, err := Open("file://"+path, Config{Holder: "prod", StaleAfter: time.Hour})
+	assert.NoError(t, err)
+
+	assert.ErrorContains(t, l.Acquire(), "run lock is held by unknown since")
+
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(-2*time.Hour)))
+	assert.NoError(t, l.Acquire())
+}
+
+func TestFileLock_TakenOverMeanwhile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dorc.lock")
+	stale := []byte(`{"holder":"crashed","acquired_at":"2026-10-18T00:00:00Z"}`)
+	fresh := []byte(`{"holder":"next","acquired_at":"2026-10-18T02:00:00Z"}`)
+	assert.NoError(t, os.WriteFile(path, fresh, 0o644))
+
+	// a second run seeing the stale lock must not remove the lock of the run which took it over
+	l := &fileLock{path: path, config: Config{Holder: "late", StaleAfter: time.Hour}, now: time.Now}
+	err := l.removeStale(stale)
+
+	assert.ErrorContains(t, err, "run lock is held by next since 2026-10-18T02:00:00Z")
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, fresh, content)
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFileLock_ConcurrentTakeover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dorc.lock")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"holder":"crashed","acquired_at":"2026-10-18T00:00:00Z"}`), 0o644))
+
+	var wg sync.WaitGroup
+	acquired := make(chan string, 10)
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			holder := "run-" + strconv.Itoa(i)
+			l := &fileLock{path: path, config: Config{Holder: holder, StaleAfter: time.Hour}, now: func() time.Time { return start }}
+			if l.Acquire() == nil {
+				acquired <- holder
+			}
+		}()
+	}
+	wg.Wait()
+	close(acquired)
+
+	var holders []string
+	for holder := range acquired {
+		holders = append(holders, holder)
+	}
+	assert.Len(t, holders, 1)
+}
+
+func TestLeaseLock_KeepsFields(t *testing.T) {
+	const path = "/apis/coordination.k8s.io/v1/namespaces/dorc/leases/dorc"
+	server, cluster := kubetest.NewServer(t)
+	cluster.Store(path, map[string]any{
+		"apiVersion": "coordination.k8s.io/v1",
+		"kind":       "Lease",
+		"metadata": map[string]any{
+			"name":        "dorc",
+			"namespace":   "dorc",
+			"labels":      map[string]any{"team": "platform"},
+			"annotations": map[string]any{"owner": "ops"},
+		},
+		"spec": map[string]any{"leaseTransitions": float64(3)},
+	})
+
+	now, _ := clock()
+	l := &leaseLock{client: kube.NewClient(server.URL, "token", "dorc"), namespace: "dorc", name: "dorc", config: Config{Holder: "prod", StaleAfter: time.Hour}, now: now}
+
+	assert.NoError(t, l.Acquire())
+	current := lease(cluster.Object(path))
+	assert.Equal(t, "prod", current.holder().ID)
+	assert.Equal(t, map[string]any{"team": "platform"}, current["metadata"].(map[string]any)["labels"])
+	assert.Equal(t, map[string]any{"owner": "ops"}, current["metadata"].(map[string]any)["annotations"])
+	assert.Equal(t, float64(3), current.spec()["leaseTransitions"])
+
+	assert.NoError(t, l.Release())
+	current = lease(cluster.Object(path))
+	assert.Empty(t, current.holder().ID)
+	assert.Equal(t, map[string]any{"team": "platform"}, current["metadata"].(map[string]any)["labels"])
+	assert.Equal(t, float64(3), current.spec()["leaseTransitions"])
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	_, err := Open("s3://bucket", Config{Holder: "prod"})
+	assert.ErrorContains(t, err, "bucket or key is missing")
+
+	_, err = Open("dorc.lock", Config{})
+	assert.ErrorContains(t, err, "lock holder is required")
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/do"
+)
+
+// Metrics are the metrics of cleanup runs.
+type Metrics struct {
+	Registry *Registry
+
+	tagsDeleted    *Vec
+	tagsKept       *Vec
+	tagsProtected  *Vec
+	reclaimedBytes *Vec
+	apiRequests    *Vec
+	apiRetries     *Vec
+	runs           *Vec
+	runDuration    *Vec
+	lastSuccess    *Vec
+}
+
+func New() *Metrics {
+	r := NewRegistry()
+
+	return &Metrics{
+		Registry:       r,
+		tagsDeleted:    r.Counter("dorc_tags_deleted_total", "Tags deleted, dry_run=\"true\" counts tags only planned for deletion.", "registry", "repository", "dry_run"),
+		tagsKept:       r.Gauge("dorc_tags_kept", "Tags kept by the last run.", "registry", "repository"),
+		tagsProtected:  r.Gauge("dorc_tags_protected", "Protected tags seen by the last run.", "registry", "repository"),
+		reclaimedBytes: r.Counter("dorc_reclaimed_bytes_total", "Estimated bytes reclaimed by deleted tags once garbage collection runs.", "registry", "repository"),
+		apiRequests:    r.Counter("dorc_api_requests_total", "DigitalOcean API requests by method and status code.", "method", "status"),
+		apiRetries:     r.Counter("dorc_api_retries_total", "Retried DigitalOcean API requests."),
+		runs:           r.Counter("dorc_runs_total", "Cleanup runs by result.", "result"),
+		runDuration:    r.Gauge("dorc_run_duration_seconds", "Duration of the last cleanup run."),
+		lastSuccess:    r.Gauge("dorc_last_success_timestamp_seconds", "Unix timestamp of the last successful cleanup run."),
+	}
+}
+
+// ObserveRequest records an API request attempt, register it with DigitalOceanClient.OnRequest.
+func (m *Metrics) ObserveRequest(event do.RequestEvent) {
+	status := "error"
+	if event.Status != 0 {
+		status = strconv.Itoa(event.Status)
+	}
+
+	m.apiRequests.Add(1, event.Method, status)
+	if event.Attempt > 1 {
+		m.apiRetries.Add(1)
+	}
+}
+
+// ObserveCleanup records the tags of the plan and the deleted ones.
+// Tags of a dry run are counted with dry_run="true" and neither reduce the kept tags nor reclaim bytes.
+func (m *Metrics) ObserveCleanup(plan *cleanup.Decisions, deleted []cleanup.Tag, dryRun bool) {
+	m.tagsDeleted.Add(float64(len(deleted)), plan.Registry, plan.Repository, strconv.FormatBool(dryRun))
+	m.tagsProtected.Set(float64(len(plan.Protected)), plan.Registry, plan.Repository)
+
+	if dryRun {
+		m.tagsKept.Set(float64(len(plan.Tags)-len(plan.Gone)), plan.Registry, plan.Repository)
+		return
+	}
+
+	freed := (&cleanup.Decisions{Tags: plan.Tags, Delete: deleted}).EstimateFreedBytes()
+	m.tagsKept.Set(float64(len(plan.Tags)-len(deleted)-len(plan.Gone)), plan.Registry, plan.Repository)
+	m.reclaimedBytes.Add(float64(freed), plan.Registry, plan.Repository)
+}
+
+// ObserveRun records the result of a run.
+func (m *Metrics) ObserveRun(startedAt, finishedAt time.Time, err error) {
+	m.runDuration.Set(finishedAt.Sub(startedAt).Seconds())
+
+	if err != nil {
+		m.runs.Add(1, "failure")
+		return
+	}
+
+	m.runs.Add(1, "success")
+	m.lastSuccess.Set(float64(finishedAt.Unix()))
+}
@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/do"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func render(t *testing.T, r *Registry) string {
+	var buf strings.Builder
+	_, err := r.WriteTo(&buf)
+	assert.NoError(t, err)
+	return buf.String()
+}
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	counter := r.Counter("test_total", "Test counter.", "repository")
+	gauge := r.Gauge("test_gauge", "Test gauge.")
+
+	counter.Add(2, "backend")
+	counter.Add(1, "backend")
+	counter.Add(1, `front"end`)
+	gauge.Set(1.5)
+
+	assert.Equal(t, `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{repository="backend"} 3
+test_total{repository="front\"end"} 1
+# HELP test_gauge Test gauge.
+# TYPE test_gauge gauge
+test_gauge 1.5
+`, render(t, r))
+	assert.Equal(t, float64(3), counter.Value("backend"))
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.Gauge("test_gauge", "Test gauge.").Set(1)
+
+	recorder := httptest.NewRecorder()
+	r.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "test_gauge 1\n")
+}
+
+func TestRegistry_Push(t *testing.T) {
+	var pushed string
+	var path string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		path = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		pushed = string(body)
+	}))
+	defer gateway.Close()
+
+	r := NewRegistry()
+	r.Gauge("test_gauge", "Test gauge.").Set(1)
+
+	assert.NoError(t, r.Push(gateway.URL, "dorc"))
+	assert.Equal(t, "/metrics/job/dorc", path)
+	assert.Equal(t, render(t, r), pushed)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New()
+
+	m.ObserveRequest(do.RequestEvent{Method: "GET", Status: 429, Attempt: 1})
+	m.ObserveRequest(do.RequestEvent{Method: "GET", Status: 200, Attempt: 2})
+	m.ObserveRequest(do.RequestEvent{Method: "DELETE", Attempt: 1, Err: errors.New("timeout")})
+
+	plan := &cleanup.Decisions{
+		Registry:   "reg",
+		Repository: "backend",
+		Tags: []cleanup.Tag{
+			{Tag: "latest", ManifestDigest: "sha256:1", CompressedSize: 100},
+			{Tag: "old", ManifestDigest: "sha256:2", CompressedSize: 200},
+			{Tag: "new", ManifestDigest: "sha256:3", CompressedSize: 300},
+		},
+		Protected: []cleanup.Tag{{Tag: "latest"}},
+	}
+	m.ObserveCleanup(plan, []cleanup.Tag{plan.Tags[1]}, false)
+
+	finishedAt := time.Unix(1760000000, 0)
+	m.ObserveRun(finishedAt.Add(-3*time.Second), finishedAt, nil)
+
+	output := render(t, m.Registry)
+	assert.Contains(t, output, `dorc_api_requests_total{method="GET",status="429"} 1`)
+	assert.Contains(t, output, `dorc_api_requests_total{method="DELETE",status="error"} 1`)
+	assert.Contains(t, output, "dorc_api_retries_total 1\n")
+	assert.Contains(t, output, `dorc_tags_deleted_total{registry="reg",repository="backend",dry_run="false"} 1`)
+	assert.Contains(t, output, `dorc_tags_kept{registry="reg",repository="backend"} 2`)
+	assert.Contains(t, output, `dorc_tags_protected{registry="reg",repository="backend"} 1`)
+	assert.Contains(t, output, `dorc_reclaimed_bytes_total{registry="reg",repository="backend"} 200`)
+	assert.Contains(t, output, `dorc_runs_total{result="success"} 1`)
+	assert.Contains(t, output, "dorc_run_duration_seconds 3\n")
+	assert.Contains(t, output, "dorc_last_success_timestamp_seconds 1.76e+09\n")
+}
+
+func TestMetrics_DryRun(t *testing.T) {
+	m := New()
+
+	plan := &cleanup.Decisions{
+		Registry:   "reg",
+		Repository: "backend",
+		Tags: []cleanup.Tag{
+			{Tag: "old", ManifestDigest: "sha256:1", CompressedSize: 100},
+			{Tag: "new", ManifestDigest: "sha256:2", CompressedSize: 200},
+		},
+	}
+	m.ObserveCleanup(plan, []cleanup.Tag{plan.Tags[0]}, true)
+
+	output := render(t, m.Registry)
+	assert.Contains(t, output, `dorc_tags_deleted_total{registry="reg",repository="backend",dry_run="true"} 1`)
+	assert.Contains(t, output, `dorc_tags_kept{registry="reg",repository="backend"} 2`)
+	assert.NotContains(t, output, "dorc_reclaimed_bytes_total{")
+}
+
+func TestVec_WrongLabelValues(t *testing.T) {
+	r := NewRegistry()
+	counter := r.Counter("test_total", "Test counter.", "repository")
+
+	assert.NotPanics(t, func() {
+		counter.Add(1)
+		counter.Add(1, "backend", "extra")
+	})
+	assert.Equal(t, `# HELP test_total Test counter.
+# TYPE test_total counter
+`, render(t, r))
+}
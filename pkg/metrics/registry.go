@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds metrics and renders them in the Prometheus text exposition format.
+//
+// dorc exposes a handful of counters and gauges without histograms, so the few lines of the text format
+// are written here instead of depending on prometheus/client_golang, which would add its dependency tree
+// (protobuf, procfs, ...) to a binary that otherwise only needs cobra and yaml.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string // counter or gauge
+	labels  []string
+	samples map[string]*sample // by joined label values
+}
+
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// Vec is a metric with labels.
+type Vec struct {
+	registry *Registry
+	family   *family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter registers a counter with the label names.
+func (r *Registry) Counter(name, help string, labels ...string) *Vec {
+	return r.register(name, help, "counter", labels)
+}
+
+// Gauge registers a gauge with the label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *Vec {
+	return r.register(name, help, "gauge", labels)
+}
+
+func (r *Registry) register(name, help, kind string, labels []string) *Vec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f := &family{name: name, help: help, kind: kind, labels: labels, samples: map[string]*sample{}}
+	r.families = append(r.families, f)
+
+	return &Vec{registry: r, family: f}
+}
+
+// Add adds the value to the sample with the label values.
+func (v *Vec) Add(value float64, labelValues ...string) {
+	v.update(labelValues, func(s *sample) { s.value += value })
+}
+
+// Set sets the sample with the label values, only gauges should be set.
+func (v *Vec) Set(value float64, labelValues ...string) {
+	v.update(labelValues, func(s *sample) { s.value = value })
+}
+
+// Value returns the value of the sample with the label values.
+func (v *Vec) Value(labelValues ...string) float64 {
+	v.registry.mu.Lock()
+	defer v.registry.mu.Unlock()
+
+	if s, ok := v.family.samples[strings.Join(labelValues, "\xff")]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// update drops samples with a wrong number of label values, a metric must never fail a run.
+func (v *Vec) update(labelValues []string, fn func(s *sample)) {
+	if len(labelValues) != len(v.family.labels) {
+		slog.Warn("dropping metric sample with wrong label values",
+			"metric", v.family.name,
+			"expected", len(v.family.labels),
+			"got", len(labelValues),
+		)
+		return
+	}
+
+	v.registry.mu.Lock()
+	defer v.registry.mu.Unlock()
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.family.samples[key]
+	if !ok {
+		s = &sample{labelValues: slices.Clone(labelValues)}
+		v.family.samples[key] = s
+	}
+	fn(s)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, f := range r.families {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", f.name, f.kind)
+
+		keys := make([]string, 0, len(f.samples))
+		for key := range f.samples {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			s := f.samples[key]
+			buf.WriteString(f.name)
+			if len(f.labels) > 0 {
+				pairs := make([]string, len(f.labels))
+				for i, label := range f.labels {
+					pairs[i] = label + `="` + escapeLabel(s.labelValues[i]) + `"`
+				}
+				buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+			}
+			buf.WriteString(" " + strconv.FormatFloat(s.value, 'g', -1, 64) + "\n")
+		}
+	}
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// Handler serves the metrics for Prometheus scraping.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// Push replaces the metrics of the job in the Prometheus Pushgateway.
+func (r *Registry) Push(gateway, job string) error {
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	addr := strings.TrimSuffix(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequest(http.MethodPut, addr, &buf)
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	req.Header.Set("User-Agent", "digitalocean-registry-cleaner")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return strings.ReplaceAll(value, `"`, `\"`)
+}
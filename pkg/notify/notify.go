@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+)
+
+// Threshold decides which runs are notified.
+type Threshold string
+
+const (
+	// Always notifies about every run.
+	Always Threshold = "always"
+	// Deletions notifies about runs which deleted tags or failed.
+	Deletions Threshold = "deletions"
+	// Failures notifies about failed runs only.
+	Failures Threshold = "failures"
+)
+
+// Summary describes the outcome of a cleanup run.
+type Summary struct {
+	RunID        string              `json:"run_id"`
+	Registry     string              `json:"registry"`
+	DryRun       bool                `json:"dry_run"`
+	StartedAt    time.Time           `json:"started_at"`
+	FinishedAt   time.Time           `json:"finished_at"`
+	Deleted      int                 `json:"deleted"`
+	Gone         int                 `json:"gone"`
+	FreedBytes   int64               `json:"freed_bytes"`
+	Failures     []string            `json:"failures"`
+	Repositories []RepositorySummary `json:"repositories"`
+}
+
+// RepositorySummary describes the outcome of a cleanup of a single repository.
+type RepositorySummary struct {
+	Repository string   `json:"repository"`
+	Deleted    []string `json:"deleted"`
+	// Gone are tags planned for deletion which were already deleted, e.g. by an overlapping run.
+	Gone       []string `json:"gone,omitempty"`
+	FreedBytes int64    `json:"freed_bytes"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Add records the outcome of a repository cleanup.
+func (s *Summary) Add(repository RepositorySummary) {
+	s.Repositories = append(s.Repositories, repository)
+	s.Deleted += len(repository.Deleted)
+	s.Gone += len(repository.Gone)
+	s.FreedBytes += repository.FreedBytes
+	if repository.Error != "" {
+		s.Failures = append(s.Failures, repository.Repository+": "+repository.Error)
+	}
+}
+
+// Fail records a failure not related to a single repository.
+func (s *Summary) Fail(err error) {
+	s.Failures = append(s.Failures, err.Error())
+}
+
+// Matches reports whether the summary should be notified at the threshold.
+func (s *Summary) Matches(threshold Threshold) bool {
+	switch threshold {
+	case Failures:
+		return len(s.Failures) > 0
+	case Deletions:
+		return len(s.Failures) > 0 || s.Deleted > 0
+	default:
+		return true
+	}
+}
+
+// DefaultTemplate renders the chat message of the Slack and Teams notifiers.
+const DefaultTemplate = `{{if .Failures}}dorc cleanup of {{.Registry}} failed{{else}}dorc cleanup of {{.Registry}} finished{{end}}{{if .DryRun}} (dry run){{end}}
+Deleted {{.Deleted}} tags, freed {{bytes .FreedBytes}}{{if .Gone}}, {{.Gone}} tags were already gone{{end}}
+{{- range .Repositories}}{{if .Deleted}}
+• {{.Repository}}: {{len .Deleted}} tags{{end}}{{end}}
+{{- range .Failures}}
+✗ {{.}}{{end}}`
+
+// Notifier delivers run summaries.
+type Notifier interface {
+	Notify(summary *Summary) error
+}
+
+// Webhook posts the summary to a URL.
+type Webhook struct {
+	Kind     string // webhook, slack or teams
+	URL      string
+	Template *template.Template
+	client   *http.Client
+}
+
+// NewWebhook creates a notifier of the kind:
+//   - webhook posts the summary as JSON, or the rendered template if set
+//   - slack posts the rendered template to a Slack-compatible incoming webhook
+//   - teams posts the rendered template as a Microsoft Teams message card
+func NewWebhook(kind, url, tmpl string) (*Webhook, error) {
+	if kind != "webhook" && kind != "slack" && kind != "teams" {
+		return nil, fmt.Errorf("unknown notifier %q", kind)
+	}
+
+	if tmpl == "" && kind != "webhook" {
+		tmpl = DefaultTemplate
+	}
+
+	w := &Webhook{Kind: kind, URL: url, client: http.DefaultClient}
+
+	if tmpl != "" {
+		t, err := template.New(kind).Funcs(template.FuncMap{"bytes": cleanup.FormatBytes}).Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification template: %w", err)
+		}
+		w.Template = t
+	}
+
+	return w, nil
+}
+
+func (w *Webhook) Notify(summary *Summary) error {
+	payload, err := w.payload(summary)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "digitalocean-registry-cleaner")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s notification failed: unexpected status code: %d", w.Kind, resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (w *Webhook) payload(summary *Summary) ([]byte, error) {
+	if w.Template == nil {
+		return json.Marshal(summary)
+	}
+
+	var text strings.Builder
+	if err := w.Template.Execute(&text, summary); err != nil {
+		return nil, fmt.Errorf("could not render notification: %w", err)
+	}
+
+	switch w.Kind {
+	case "slack":
+		return json.Marshal(map[string]string{"text": text.String()})
+	case "teams":
+		color := "2EB886"
+		if len(summary.Failures) > 0 {
+			color = "D9534F"
+		}
+		title, body, _ := strings.Cut(text.String(), "\n")
+		return json.Marshal(map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"themeColor": color,
+			"summary":    title,
+			"title":      title,
+			// Teams renders markdown, line breaks need two trailing spaces
+			"text": strings.ReplaceAll(body, "\n", "  \n"),
+		})
+	default:
+		return []byte(text.String()), nil
+	}
+}
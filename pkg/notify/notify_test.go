@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSummary() *Summary {
+	summary := &Summary{RunID: "run-1", Registry: "my-registry"}
+	summary.Add(RepositorySummary{Repository: "backend", Deleted: []string{"a", "b"}, FreedBytes: 3 << 20})
+	summary.Add(RepositorySummary{Repository: "frontend", Error: "could not list tags"})
+	return summary
+}
+
+func capture(t *testing.T) (*httptest.Server, *[]byte) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &body
+}
+
+func TestSummary(t *testing.T) {
+	summary := testSummary()
+
+	assert.Equal(t, 2, summary.Deleted)
+	assert.Equal(t, 0, summary.Gone)
+	assert.Equal(t, int64(3<<20), summary.FreedBytes)
+	assert.Equal(t, []string{"frontend: could not list tags"}, summary.Failures)
+
+	summary.Fail(errors.New("could not get registry"))
+	assert.Len(t, summary.Failures, 2)
+}
+
+func TestSummary_Matches(t *testing.T) {
+	empty := &Summary{}
+	deleted := &Summary{Deleted: 1}
+	failed := &Summary{Failures: []string{"boom"}}
+
+	assert.True(t, empty.Matches(Always))
+	assert.False(t, empty.Matches(Deletions))
+	assert.True(t, deleted.Matches(Deletions))
+	assert.True(t, failed.Matches(Deletions))
+	assert.False(t, deleted.Matches(Failures))
+	assert.True(t, failed.Matches(Failures))
+}
+
+func TestWebhook_JSON(t *testing.T) {
+	server, body := capture(t)
+
+	notifier, err := NewWebhook("webhook", server.URL, "")
+	assert.NoError(t, err)
+	assert.NoError(t, notifier.Notify(testSummary()))
+
+	var summary Summary
+	assert.NoError(t, json.Unmarshal(*body, &summary))
+	assert.Equal(t, *testSummary(), summary)
+}
+
+func TestWebhook_Slack(t *testing.T) {
+	server, body := capture(t)
+
+	notifier, err := NewWebhook("slack", server.URL, "")
+	assert.NoError(t, err)
+	assert.NoError(t, notifier.Notify(testSummary()))
+
+	var message map[string]string
+	assert.NoError(t, json.Unmarshal(*body, &message))
+	assert.Equal(t, "dorc cleanup of my-registry failed\nDeleted 2 tags, freed 3.0 MiB\n• backend: 2 tags\n✗ frontend: could not list tags", message["text"])
+}
+
+func TestWebhook_Teams(t *testing.T) {
+	server, body := capture(t)
+
+	notifier, err := NewWebhook("teams", server.URL, "Run {{.RunID}}\n{{.Deleted}} deleted")
+	assert.NoError(t, err)
+	assert.NoError(t, notifier.Notify(testSummary()))
+
+	var card map[string]string
+	assert.NoError(t, json.Unmarshal(*body, &card))
+	assert.Equal(t, "MessageCard", card["@type"])
+	assert.Equal(t, "Run run-1", card["title"])
+	assert.Equal(t, "2 deleted", card["text"])
+	assert.Equal(t, "D9534F", card["themeColor"])
+}
+
+func TestWebhook_Errors(t *testing.T) {
+	_, err := NewWebhook("email", "http://localhost", "")
+	assert.Error(t, err)
+
+	_, err = NewWebhook("slack", "http://localhost", "{{.Broken")
+	assert.Error(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	notifier, err := NewWebhook("slack", server.URL, "")
+	assert.NoError(t, err)
+	assert.Error(t, notifier.Notify(testSummary()))
+}
+
+func TestSummary_Gone(t *testing.T) {
+	summary := &Summary{Registry: "my-registry"}
+	summary.Add(RepositorySummary{Repository: "backend", Deleted: []string{"a"}, Gone: []string{"b", "c"}})
+
+	assert.Equal(t, 1, summary.Deleted)
+	assert.Equal(t, 2, summary.Gone)
+	assert.Empty(t, summary.Failures)
+
+	server, body := capture(t)
+	notifier, err := NewWebhook("slack", server.URL, "")
+	assert.NoError(t, err)
+	assert.NoError(t, notifier.Notify(summary))
+
+	var message map[string]string
+	assert.NoError(t, json.Unmarshal(*body, &message))
+	assert.Equal(t, "dorc cleanup of my-registry finished\nDeleted 1 tags, freed 0 B, 2 tags were already gone\n• backend: 1 tags", message["text"])
+}
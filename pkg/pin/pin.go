@@ -0,0 +1,343 @@
+// Package pin stores pins keeping tags until their expiry whatever the retention policy decides,
+// in a local file, a Kubernetes ConfigMap or an object of an S3-compatible bucket.
+package pin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/fsutil"
+	"digitalocean-registry-cleaner/pkg/kube"
+	"digitalocean-registry-cleaner/pkg/s3"
+)
+
+// maxAttempts bounds the retries of updates conflicting with concurrent updates.
+const maxAttempts = 5
+
+// dataKey is the key of the pins in a ConfigMap.
+const dataKey = "pins.json"
+
+// Pin keeps a tag of a repository until the time.
+type Pin struct {
+	Registry   string    `json:"registry"`
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag"`
+	Until      time.Time `json:"until"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Expired reports whether the pin no longer keeps the tag at the time now.
+func (p Pin) Expired(now time.Time) bool {
+	return !p.Until.After(now)
+}
+
+// matches reports whether the pin keeps the tag of the repository.
+func (p Pin) matches(registry, repository, tag string) bool {
+	return p.Registry == registry && p.Repository == repository && p.Tag == tag
+}
+
+// state is the content stored by every backend.
+type state struct {
+	Pins []Pin `json:"pins"`
+}
+
+// Store persists the pins.
+type Store interface {
+	// Load returns all pins, expired pins included.
+	Load() ([]Pin, error)
+	// Update replaces the pins by the result of the function applied to the current pins.
+	// The function is called again if the pins were updated concurrently.
+	Update(update func(pins []Pin) ([]Pin, error)) error
+}
+
+// Config configures the store.
+type Config struct {
+	// S3 configures the S3-compatible storage used by s3:// stores.
+	S3 s3.Config
+}
+
+// Open returns the store of the target:
+//   - "configmap://namespace/name" is a Kubernetes ConfigMap, the namespace defaults to the namespace of the pod
+//   - "s3://bucket/key" is an object in an S3-compatible bucket updated with conditional writes
+//   - anything else is a path of a local file
+func Open(target string, config Config) (Store, error) {
+	switch {
+	case strings.HasPrefix(target, "configmap://"):
+		client, err := kube.NewInCluster()
+		if err != nil {
+			return nil, fmt.Errorf("could not create Kubernetes client: %w", err)
+		}
+
+		namespace, name, found := strings.Cut(strings.TrimPrefix(target, "configmap://"), "/")
+		if !found {
+			namespace, name = client.Namespace, namespace
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid pins target %q: configmap name is missing", target)
+		}
+
+		return &configMapStore{client: client, namespace: namespace, name: name}, nil
+	case strings.HasPrefix(target, "s3://"):
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(target, "s3://"), "/")
+		if bucket == "" || key == "" {
+			return nil, fmt.Errorf("invalid pins target %q: bucket or key is missing", target)
+		}
+
+		client, err := s3.New(config.S3)
+		if err != nil {
+			return nil, fmt.Errorf("could not create S3 client: %w", err)
+		}
+
+		return &s3Store{client: client, bucket: bucket, key: key}, nil
+	default:
+		return &fileStore{path: strings.TrimPrefix(target, "file://")}, nil
+	}
+}
+
+// Add replaces the pin of the same tag, expired pins are dropped.
+func Add(pins []Pin, pin Pin, now time.Time) []Pin {
+	pins = slices.DeleteFunc(slices.Clone(pins), func(p Pin) bool {
+		return p.Expired(now) || p.matches(pin.Registry, pin.Repository, pin.Tag)
+	})
+	return append(pins, pin)
+}
+
+// Remove removes the pin of the tag, expired pins are dropped. Reports whether the tag was pinned.
+func Remove(pins []Pin, registry, repository, tag string, now time.Time) ([]Pin, bool) {
+	found := false
+	pins = slices.DeleteFunc(slices.Clone(pins), func(p Pin) bool {
+		if p.matches(registry, repository, tag) {
+			found = true
+			return true
+		}
+		return p.Expired(now)
+	})
+	return pins, found
+}
+
+// ForRepository returns the pins of the repository for the retention policy.
+func ForRepository(pins []Pin, registry, repository string) []cleanup.Pin {
+	var result []cleanup.Pin
+	for _, p := range pins {
+		if p.Registry == registry && p.Repository == repository {
+			result = append(result, cleanup.Pin{Tag: p.Tag, Until: p.Until, Reason: p.Reason})
+		}
+	}
+	return result
+}
+
+func unmarshal(content []byte) ([]Pin, error) {
+	var s state
+	if err := json.Unmarshal(content, &s); err != nil {
+		return nil, fmt.Errorf("could not unmarshal pins: %w", err)
+	}
+	return s.Pins, nil
+}
+
+func marshal(pins []Pin) ([]byte, error) {
+	if pins == nil {
+		pins = []Pin{}
+	}
+	content, err := json.MarshalIndent(state{Pins: pins}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal pins: %w", err)
+	}
+	return content, nil
+}
+
+// fileStore is a local JSON file replaced atomically, concurrent updates from several hosts are not detected.
+type fileStore struct {
+	path string
+}
+
+func (s *fileStore) Load() ([]Pin, error) {
+	content, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read pins file: %w", err)
+	}
+
+	return unmarshal(content)
+}
+
+func (s *fileStore) Update(update func(pins []Pin) ([]Pin, error)) error {
+	pins, err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	pins, err = update(pins)
+	if err != nil {
+		return err
+	}
+
+	content, err := marshal(pins)
+	if err != nil {
+		return err
+	}
+
+	if err := fsutil.WriteFile(s.path, content); err != nil {
+		return fmt.Errorf("could not write pins file: %w", err)
+	}
+
+	return nil
+}
+
+// s3Store is an object updated with conditional writes (If-Match).
+type s3Store struct {
+	client *s3.Client
+	bucket string
+	key    string
+}
+
+func (s *s3Store) Load() ([]Pin, error) {
+	pins, _, err := s.load()
+	return pins, err
+}
+
+// load returns the pins and the ETag of the object, an empty ETag if it does not exist.
+func (s *s3Store) load() ([]Pin, string, error) {
+	body, etag, err := s.client.GetObjectETag(s.bucket, s.key)
+	if errors.Is(err, s3.ErrNotFound) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read pins object: %w", err)
+	}
+
+	pins, err := unmarshal(body)
+	return pins, etag, err
+}
+
+func (s *s3Store) Update(update func(pins []Pin) ([]Pin, error)) error {
+	for attempt := 1; ; attempt++ {
+		pins, etag, err := s.load()
+		if err != nil {
+			return err
+		}
+
+		pins, err = update(pins)
+		if err != nil {
+			return err
+		}
+
+		content, err := marshal(pins)
+		if err != nil {
+			return err
+		}
+
+		cond := s3.Condition{IfMatch: etag}
+		if etag == "" {
+			cond = s3.Condition{IfNoneMatch: "*"}
+		}
+
+		err = s.client.PutObjectIf(s.bucket, s.key, content, "application/json", cond)
+		if errors.Is(err, s3.ErrPreconditionFailed) && attempt < maxAttempts {
+			continue // updated concurrently
+		}
+		if err != nil {
+			return fmt.Errorf("could not write pins object: %w", err)
+		}
+		return nil
+	}
+}
+
+// configMap is a v1 ConfigMap.
+type configMap struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// configMapStore is a Kubernetes ConfigMap.
+// The API server rejects updates of outdated ConfigMaps, so concurrent updates are retried.
+type configMapStore struct {
+	client    *kube.Client
+	namespace string
+	name      string
+}
+
+func (s *configMapStore) path() string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/configmaps", s.namespace)
+}
+
+func (s *configMapStore) Load() ([]Pin, error) {
+	pins, _, err := s.load()
+	return pins, err
+}
+
+// load returns the pins and the ConfigMap, nil if it does not exist.
+func (s *configMapStore) load() ([]Pin, *configMap, error) {
+	var current configMap
+	err := s.client.Get(s.path()+"/"+s.name, &current)
+	if errors.Is(err, kube.ErrNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get configmap: %w", err)
+	}
+
+	content, ok := current.Data[dataKey]
+	if !ok {
+		return nil, &current, nil
+	}
+
+	pins, err := unmarshal([]byte(content))
+	return pins, &current, err
+}
+
+func (s *configMapStore) Update(update func(pins []Pin) ([]Pin, error)) error {
+	for attempt := 1; ; attempt++ {
+		pins, current, err := s.load()
+		if err != nil {
+			return err
+		}
+
+		pins, err = update(pins)
+		if err != nil {
+			return err
+		}
+
+		content, err := marshal(pins)
+		if err != nil {
+			return err
+		}
+
+		if current == nil {
+			current = &configMap{APIVersion: "v1", Kind: "ConfigMap"}
+			current.Metadata.Name = s.name
+			current.Metadata.Namespace = s.namespace
+			current.Data = map[string]string{dataKey: string(content)}
+			err = s.client.Create(s.path(), current, nil)
+		} else {
+			if current.Data == nil {
+				current.Data = map[string]string{}
+			}
+			current.Data[dataKey] = string(content)
+			err = s.client.Update(s.path()+"/"+s.name, current, nil)
+		}
+		if errors.Is(err, kube.ErrConflict) && attempt < maxAttempts {
+			continue // updated concurrently
+		}
+		if err != nil {
+			return fmt.Errorf("could not write configmap: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,163 @@
+package pin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/kube"
+	"digitalocean-registry-cleaner/pkg/kube/kubetest"
+	"digitalocean-registry-cleaner/pkg/s3"
+	"digitalocean-registry-cleaner/pkg/s3/s3test"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+
+func testPin(repository, tag string, until time.Time) Pin {
+	return Pin{Registry: "my-registry", Repository: repository, Tag: tag, Until: until, CreatedAt: now}
+}
+
+// testStores returns a store of every backend, each starting empty
+func testStores(t *testing.T) map[string]Store {
+	storage, _ := s3test.NewServer(t)
+	cluster, _ := kubetest.NewServer(t)
+
+	file, err := Open(filepath.Join(t.TempDir(), "pins.json"), Config{})
+	assert.NoError(t, err)
+
+	object, err := Open("s3://bucket/pins.json", Config{S3: s3.Config{Endpoint: storage.URL, AccessKey: s3test.AccessKey, SecretKey: s3test.SecretKey}})
+	assert.NoError(t, err)
+
+	return map[string]Store{
+		"file":      file,
+		"s3":        object,
+		"configmap": &configMapStore{client: kube.NewClient(cluster.URL, "token", "dorc"), namespace: "dorc", name: "dorc-pins"},
+	}
+}
+
+func TestStore(t *testing.T) {
+	for backend, store := range testStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			pins, err := store.Load()
+			assert.NoError(t, err)
+			assert.Empty(t, pins)
+
+			incident := testPin("backend", "feature-x", now.Add(7*24*time.Hour))
+			incident.Reason = "INC-42"
+			assert.NoError(t, store.Update(func(pins []Pin) ([]Pin, error) {
+				return Add(pins, incident, now), nil
+			}))
+			assert.NoError(t, store.Update(func(pins []Pin) ([]Pin, error) {
+				return Add(pins, testPin("frontend", "feature-y", now.Add(24*time.Hour)), now), nil
+			}))
+
+			pins, err = store.Load()
+			assert.NoError(t, err)
+			assert.Len(t, pins, 2)
+			assert.Equal(t, incident, pins[0])
+
+			assert.NoError(t, store.Update(func(pins []Pin) ([]Pin, error) {
+				pins, _ = Remove(pins, "my-registry", "frontend", "feature-y", now)
+				return pins, nil
+			}))
+
+			pins, err = store.Load()
+			assert.NoError(t, err)
+			assert.Equal(t, []Pin{incident}, pins)
+
+			// a failed update keeps the pins
+			assert.Error(t, store.Update(func(pins []Pin) ([]Pin, error) {
+				return nil, errors.New("not pinned")
+			}))
+			pins, err = store.Load()
+			assert.NoError(t, err)
+			assert.Equal(t, []Pin{incident}, pins)
+		})
+	}
+}
+
+func TestStore_ConcurrentUpdates(t *testing.T) {
+	for backend, store := range testStores(t) {
+		if backend == "file" {
+			continue // concurrent updates of a file are not detected
+		}
+		t.Run(backend, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := range 4 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, store.Update(func(pins []Pin) ([]Pin, error) {
+						return Add(pins, testPin("backend", "tag-"+strconv.Itoa(i), now.Add(time.Hour)), now), nil
+					}))
+				}()
+			}
+			wg.Wait()
+
+			pins, err := store.Load()
+			assert.NoError(t, err)
+			assert.Len(t, pins, 4)
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	pins := []Pin{
+		testPin("backend", "feature-x", now.Add(time.Hour)),
+		testPin("backend", "expired", now.Add(-time.Hour)),
+	}
+
+	extended := testPin("backend", "feature-x", now.Add(48*time.Hour))
+	assert.Equal(t, []Pin{extended}, Add(pins, extended, now))
+	assert.Len(t, pins, 2)
+}
+
+func TestRemove(t *testing.T) {
+	pins := []Pin{
+		testPin("backend", "feature-x", now.Add(time.Hour)),
+		testPin("frontend", "feature-x", now.Add(time.Hour)),
+		testPin("backend", "expired", now.Add(-time.Hour)),
+	}
+
+	remaining, found := Remove(pins, "my-registry", "backend", "feature-x", now)
+	assert.True(t, found)
+	assert.Equal(t, []Pin{pins[1]}, remaining)
+
+	_, found = Remove(pins, "my-registry", "backend", "missing", now)
+	assert.False(t, found)
+}
+
+func TestForRepository(t *testing.T) {
+	pins := []Pin{
+		testPin("backend", "feature-x", now.Add(time.Hour)),
+		testPin("frontend", "feature-y", now.Add(time.Hour)),
+		{Registry: "other", Repository: "backend", Tag: "feature-z", Until: now.Add(time.Hour)},
+	}
+	pins[0].Reason = "INC-42"
+
+	assert.Equal(t, []cleanup.Pin{{Tag: "feature-x", Until: now.Add(time.Hour), Reason: "INC-42"}}, ForRepository(pins, "my-registry", "backend"))
+	assert.Empty(t, ForRepository(pins, "my-registry", "api"))
+}
+
+func TestFileStore_Corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pins.json")
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+
+	store, err := Open("file://"+path, Config{})
+	assert.NoError(t, err)
+
+	_, err = store.Load()
+	assert.ErrorContains(t, err, "could not unmarshal pins")
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	_, err := Open("s3://bucket", Config{})
+	assert.ErrorContains(t, err, "bucket or key is missing")
+}
@@ -0,0 +1,156 @@
+package quarantine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/fsutil"
+)
+
+// Entry records a deleted tag and the manifest it pointed to.
+// The manifest and its blobs stay in the registry until garbage collection runs,
+// so the tag can be re-created until then.
+type Entry struct {
+	RunID      string     `json:"run_id"`
+	Registry   string     `json:"registry"`
+	Repository string     `json:"repository"`
+	Tag        string     `json:"tag"`
+	Digest     string     `json:"digest"`
+	DeletedAt  time.Time  `json:"deleted_at"`
+	RestoredAt *time.Time `json:"restored_at,omitempty"`
+	// Planned entries are recorded before the tag is deleted, the tag may still exist if the run was interrupted.
+	Planned bool `json:"planned,omitempty"`
+}
+
+// State is the list of quarantined tags stored in a JSON file.
+type State struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Load reads the state file, a missing file is an empty state.
+func Load(path string) (*State, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read quarantine state: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("could not unmarshal quarantine state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// Save writes the state file atomically.
+func (s *State) Save(path string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal quarantine state: %w", err)
+	}
+
+	if err := fsutil.WriteFile(path, content); err != nil {
+		return fmt.Errorf("could not write quarantine state: %w", err)
+	}
+
+	return nil
+}
+
+// Add records the entries.
+func (s *State) Add(entries ...Entry) {
+	s.Entries = append(s.Entries, entries...)
+}
+
+// Plan records the tags the run is about to delete as planned, so their digests stay restorable
+// if the run is interrupted while deleting.
+func (s *State) Plan(runID string, plan *cleanup.Decisions, plannedAt time.Time) {
+	for _, tag := range plan.Delete {
+		s.Add(Entry{
+			RunID:      runID,
+			Registry:   plan.Registry,
+			Repository: plan.Repository,
+			Tag:        tag.Tag,
+			Digest:     tag.ManifestDigest,
+			DeletedAt:  plannedAt.UTC(),
+			Planned:    true,
+		})
+	}
+}
+
+// Record confirms the tags of the plan deleted by the run, tags which were already gone
+// or failed to delete are not restorable and their planned entries are removed.
+func (s *State) Record(runID string, plan *cleanup.Decisions, deleted []cleanup.Tag, deletedAt time.Time) {
+	confirmed := map[string]bool{}
+	for _, tag := range deleted {
+		confirmed[tag.Tag] = false
+	}
+
+	var entries []Entry
+	for _, entry := range s.Entries {
+		if entry.Planned && entry.RunID == runID && entry.Registry == plan.Registry && entry.Repository == plan.Repository {
+			if _, ok := confirmed[entry.Tag]; !ok {
+				continue
+			}
+			confirmed[entry.Tag] = true
+			entry.Planned = false
+			entry.DeletedAt = deletedAt.UTC()
+		}
+		entries = append(entries, entry)
+	}
+	s.Entries = entries
+
+	for _, tag := range deleted {
+		if confirmed[tag.Tag] {
+			continue
+		}
+		s.Add(Entry{
+			RunID:      runID,
+			Registry:   plan.Registry,
+			Repository: plan.Repository,
+			Tag:        tag.Tag,
+			Digest:     tag.ManifestDigest,
+			DeletedAt:  deletedAt.UTC(),
+		})
+	}
+}
+
+// Run returns the indexes of entries of the run which were not restored yet.
+func (s *State) Run(runID string) []int {
+	var indexes []int
+	for i, entry := range s.Entries {
+		if entry.RunID == runID && entry.RestoredAt == nil {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// Pending returns entries deleted after the time which were not restored yet.
+func (s *State) Pending(after time.Time) []Entry {
+	var entries []Entry
+	for _, entry := range s.Entries {
+		if entry.RestoredAt == nil && entry.DeletedAt.After(after) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Prune removes entries of the registry deleted before the time, they cannot be restored
+// once garbage collection started.
+func (s *State) Prune(registry string, before time.Time) {
+	var entries []Entry
+	for _, entry := range s.Entries {
+		if entry.Registry != registry || entry.DeletedAt.After(before) {
+			entries = append(entries, entry)
+		}
+	}
+	s.Entries = entries
+}
@@ -0,0 +1,138 @@
+package quarantine
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_Missing(t *testing.T) {
+	state, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+
+	assert.NoError(t, err)
+	assert.Empty(t, state.Entries)
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.json")
+	deletedAt := time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+
+	state := &State{}
+	state.Add(Entry{RunID: "run-1", Registry: "reg", Repository: "backend", Tag: "a", Digest: "sha256:a", DeletedAt: deletedAt})
+	assert.NoError(t, state.Save(path))
+
+	loaded, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, state, loaded)
+}
+
+func TestRun(t *testing.T) {
+	restoredAt := time.Now()
+	state := &State{Entries: []Entry{
+		{RunID: "run-1", Tag: "a"},
+		{RunID: "run-2", Tag: "b"},
+		{RunID: "run-1", Tag: "c", RestoredAt: &restoredAt},
+		{RunID: "run-1", Tag: "d"},
+	}}
+
+	assert.Equal(t, []int{0, 3}, state.Run("run-1"))
+	assert.Empty(t, state.Run("run-3"))
+}
+
+func TestPendingPrune(t *testing.T) {
+	now := time.Now()
+	restoredAt := now
+	state := &State{Entries: []Entry{
+		{Registry: "reg", Tag: "old", DeletedAt: now.Add(-96 * time.Hour)},
+		{Registry: "reg", Tag: "new", DeletedAt: now.Add(-1 * time.Hour)},
+		{Registry: "reg", Tag: "restored", DeletedAt: now.Add(-1 * time.Hour), RestoredAt: &restoredAt},
+		{Registry: "other", Tag: "other", DeletedAt: now.Add(-96 * time.Hour)},
+	}}
+
+	pending := state.Pending(now.Add(-72 * time.Hour))
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "new", pending[0].Tag)
+
+	state.Prune("reg", now)
+	assert.Len(t, state.Entries, 1)
+	assert.Equal(t, "other", state.Entries[0].Tag)
+}
+
+// deleter fails to delete some tags and does not find others
+type deleter struct {
+	failing string
+	gone    string
+}
+
+func (d deleter) DeleteTag(registry, repository, tag string) error {
+	switch tag {
+	case d.failing:
+		return errors.New("internal server error")
+	case d.gone:
+		return fmt.Errorf("tag %s: %w", tag, cleanup.ErrNotFound)
+	}
+	return nil
+}
+
+func TestRecord_OnlyDeleted(t *testing.T) {
+	deletedAt := time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+	plan := &cleanup.Decisions{
+		Registry:   "reg",
+		Repository: "backend",
+		Delete: []cleanup.Tag{
+			{Tag: "a", ManifestDigest: "sha256:a"},
+			{Tag: "gone", ManifestDigest: "sha256:gone"},
+			{Tag: "failing", ManifestDigest: "sha256:failing"},
+			{Tag: "b", ManifestDigest: "sha256:b"},
+		},
+	}
+
+	executor := &cleanup.Executor{Deleter: deleter{failing: "failing", gone: "gone"}}
+	deleted, err := executor.Execute(plan, false)
+	assert.Error(t, err)
+
+	state := &State{}
+	state.Record("run-1", plan, deleted, deletedAt)
+
+	assert.Equal(t, []Entry{
+		{RunID: "run-1", Registry: "reg", Repository: "backend", Tag: "a", Digest: "sha256:a", DeletedAt: deletedAt},
+	}, state.Entries)
+	assert.Equal(t, []cleanup.Tag{{Tag: "gone", ManifestDigest: "sha256:gone"}}, plan.Gone)
+}
+
+func TestPlanRecord(t *testing.T) {
+	plannedAt := time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+	deletedAt := plannedAt.Add(time.Minute)
+	plan := &cleanup.Decisions{
+		Registry:   "reg",
+		Repository: "backend",
+		Delete: []cleanup.Tag{
+			{Tag: "a", ManifestDigest: "sha256:a"},
+			{Tag: "failing", ManifestDigest: "sha256:failing"},
+		},
+	}
+
+	state := &State{Entries: []Entry{{RunID: "run-0", Registry: "reg", Repository: "backend", Tag: "failing", Digest: "sha256:old", DeletedAt: plannedAt}}}
+	state.Plan("run-1", plan, plannedAt)
+
+	// an interrupted run keeps the digests of all planned tags
+	path := filepath.Join(t.TempDir(), "state.json")
+	assert.NoError(t, state.Save(path))
+	loaded, err := Load(path)
+	assert.NoError(t, err)
+	assert.Len(t, loaded.Entries, 3)
+	assert.True(t, loaded.Entries[1].Planned)
+	assert.True(t, loaded.Entries[2].Planned)
+
+	state.Record("run-1", plan, plan.Delete[:1], deletedAt)
+	assert.Equal(t, []Entry{
+		{RunID: "run-0", Registry: "reg", Repository: "backend", Tag: "failing", Digest: "sha256:old", DeletedAt: plannedAt},
+		{RunID: "run-1", Registry: "reg", Repository: "backend", Tag: "a", Digest: "sha256:a", DeletedAt: deletedAt},
+	}, state.Entries)
+}
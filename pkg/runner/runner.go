@@ -0,0 +1,352 @@
+// Package runner executes cleanup plans the way every dorc command deleting tags does: after the pre-flight check
+// and under the run lock, recording the deleted tags in the metrics, the audit log, the quarantine state and the
+// summary of the run, which is notified when the run finishes.
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/audit"
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/do"
+	"digitalocean-registry-cleaner/pkg/lock"
+	"digitalocean-registry-cleaner/pkg/metrics"
+	"digitalocean-registry-cleaner/pkg/notify"
+	"digitalocean-registry-cleaner/pkg/quarantine"
+	"digitalocean-registry-cleaner/pkg/s3"
+)
+
+// Client is the part of the DigitalOcean client used by a run.
+type Client interface {
+	Preflight(registry string, repositories []string, write bool) []do.Problem
+	ExecutePlan(plan *cleanup.Decisions, dryRun bool) ([]cleanup.Tag, error)
+}
+
+// Config configures the runs of a registry.
+type Config struct {
+	Registry string
+	DryRun   bool
+
+	// Lock is the target of the run lock (see lock.Open), empty runs without a lock. Dry runs do not take it.
+	Lock string
+	// LockHolder identifies the process, e.g. hostname and process ID, the run ID is appended to it.
+	LockHolder string
+	// LockStaleAfter is the time after which the lock is taken over unless renewed,
+	// it is renewed every third of it while the run is in progress.
+	LockStaleAfter time.Duration
+
+	// AuditLog is the target of the audit log (see audit.Open), empty disables it.
+	AuditLog string
+	// QuarantineState is the state file recording the deleted tags, empty disables it.
+	QuarantineState string
+	// S3 configures the storage of s3:// locks and audit logs.
+	S3 s3.Config
+
+	Notifiers []notify.Notifier
+	NotifyOn  notify.Threshold
+
+	// Metrics records the run, nil disables them.
+	Metrics *metrics.Metrics
+}
+
+// Run is a cleanup run of the repositories of a registry.
+type Run struct {
+	// Summary is the outcome of the run.
+	Summary *notify.Summary
+
+	client Client
+	config Config
+	lock   lock.Lock
+	sink   audit.Sink
+	state  *quarantine.State
+
+	// stop ends the renewal of the lock, done is closed once it ended
+	stop chan struct{}
+	done chan struct{}
+
+	mu      sync.Mutex
+	lockErr error // the lock was lost
+}
+
+// Start checks that the repositories can be cleaned up, takes the run lock and opens the audit log and the
+// quarantine state. Finish must be called once the plans are executed.
+func Start(client Client, config Config, repositories []string) (*Run, error) {
+	// fail before planning anything if the token, registry or repositories cannot be used
+	if problems := client.Preflight(config.Registry, repositories, !config.DryRun); len(problems) > 0 {
+		return nil, &PreflightError{Problems: problems}
+	}
+
+	r := &Run{client: client, config: config}
+	r.Summary = &notify.Summary{
+		RunID:     audit.NewRunID(time.Now()),
+		Registry:  config.Registry,
+		DryRun:    config.DryRun,
+		StartedAt: time.Now().UTC(),
+	}
+
+	// dry runs delete nothing and may overlap
+	if config.Lock != "" && !config.DryRun {
+		holder := r.Summary.RunID
+		if config.LockHolder != "" {
+			holder = config.LockHolder + "/" + holder
+		}
+		l, err := lock.Open(config.Lock, lock.Config{Holder: holder, StaleAfter: config.LockStaleAfter, S3: config.S3})
+		if err != nil {
+			return nil, err
+		}
+		if err := l.Acquire(); err != nil {
+			return nil, fmt.Errorf("could not acquire run lock %s: %w", config.Lock, err)
+		}
+		slog.Info("acquired run lock", "lock", config.Lock, "holder", holder)
+		r.lock = l
+		r.renew()
+	}
+
+	if err := r.open(); err != nil {
+		if r.sink != nil {
+			_ = r.sink.Close()
+		}
+		r.release()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// open opens the audit log and loads the quarantine state.
+func (r *Run) open() error {
+	var err error
+
+	if r.config.AuditLog != "" {
+		r.sink, err = audit.Open(r.config.AuditLog, r.Summary.RunID, r.config.S3)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.config.QuarantineState != "" {
+		r.state, err = quarantine.Load(r.config.QuarantineState)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renew renews the lock every third of its stale time until the run finishes, a lock which never becomes stale
+// is not renewed.
+func (r *Run) renew() {
+	if r.config.LockStaleAfter <= 0 {
+		return
+	}
+
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.config.LockStaleAfter / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+
+			err := r.lock.Renew()
+			if err == nil {
+				continue
+			}
+			slog.Error("could not renew run lock", "lock", r.config.Lock, "error", err)
+			if errors.Is(err, lock.ErrLocked) {
+				r.mu.Lock()
+				r.lockErr = err
+				r.mu.Unlock()
+				return
+			}
+		}
+	}()
+}
+
+// lost returns the error of a lock taken over by another run.
+func (r *Run) lost() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lockErr
+}
+
+// Check refuses the whole run before deleting anything if a plan exceeds its safety limits.
+func (r *Run) Check(plans []*cleanup.Decisions) error {
+	var errs []error
+	for _, plan := range plans {
+		if err := plan.Check(); err != nil {
+			r.Summary.Add(notify.RepositorySummary{Repository: plan.Repository, Deleted: []string{}, Error: err.Error()})
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Execute deletes the tags of the plan and records the deleted ones.
+// Returns the deleted tags, in dry-run mode the tags which would be deleted.
+func (r *Run) Execute(plan *cleanup.Decisions) ([]cleanup.Tag, error) {
+	// another run may be deleting tags already
+	if err := r.lost(); err != nil {
+		err = fmt.Errorf("cleanup failed: %w", err)
+		r.Summary.Add(notify.RepositorySummary{Repository: plan.Repository, Deleted: []string{}, Error: err.Error()})
+		return nil, err
+	}
+
+	quarantined := r.state != nil && !r.config.DryRun && len(plan.Delete) > 0
+	if quarantined {
+		// the digests must stay restorable if the run is interrupted while deleting
+		r.state.Plan(r.Summary.RunID, plan, time.Now())
+		if err := r.state.Save(r.config.QuarantineState); err != nil {
+			err = fmt.Errorf("cleanup failed: %w", err)
+			r.Summary.Add(notify.RepositorySummary{Repository: plan.Repository, Deleted: []string{}, Error: err.Error()})
+			return nil, err
+		}
+	}
+
+	deleted, err := r.client.ExecutePlan(plan, r.config.DryRun)
+	if err != nil {
+		err = fmt.Errorf("cleanup failed: %w", err)
+	}
+	if r.config.Metrics != nil {
+		r.config.Metrics.ObserveCleanup(plan, deleted, r.config.DryRun)
+	}
+
+	if quarantined {
+		// the manifests of the deleted tags stay in the registry until garbage collection
+		r.state.Record(r.Summary.RunID, plan, deleted, time.Now())
+		if saveErr := r.state.Save(r.config.QuarantineState); saveErr != nil {
+			err = errors.Join(err, fmt.Errorf("cleanup failed: %w", saveErr))
+		}
+	}
+
+	repositorySummary := notify.RepositorySummary{
+		Repository: plan.Repository,
+		Deleted:    cleanup.TagNames(deleted),
+		FreedBytes: (&cleanup.Decisions{Tags: plan.Tags, Delete: deleted}).EstimateFreedBytes(),
+	}
+	if len(plan.Gone) > 0 {
+		repositorySummary.Gone = cleanup.TagNames(plan.Gone)
+	}
+	if err != nil {
+		repositorySummary.Error = err.Error()
+	}
+	r.Summary.Add(repositorySummary)
+
+	if r.sink != nil && len(deleted) > 0 {
+		if auditErr := r.sink.Write(auditRecords(r.Summary.RunID, plan, deleted, r.config.DryRun)); auditErr != nil {
+			err = errors.Join(err, auditErr)
+		}
+	}
+
+	return deleted, err
+}
+
+// Finish records the result of the run, notifies about it and releases the run lock.
+func (r *Run) Finish(err error) {
+	if r.sink != nil {
+		if closeErr := r.sink.Close(); closeErr != nil {
+			slog.Error("could not close audit log", "audit_log", r.config.AuditLog, "error", closeErr)
+		}
+	}
+
+	summary := r.Summary
+	summary.FinishedAt = time.Now().UTC()
+	if r.config.Metrics != nil {
+		r.config.Metrics.ObserveRun(summary.StartedAt, summary.FinishedAt, err)
+	}
+	if err != nil && len(summary.Failures) == 0 {
+		summary.Fail(err)
+	}
+
+	slog.Info("run finished",
+		"run_id", summary.RunID,
+		"registry", summary.Registry,
+		"deleted", summary.Deleted,
+		"gone", summary.Gone,
+		"freed_bytes", summary.FreedBytes,
+		"duration", summary.FinishedAt.Sub(summary.StartedAt),
+		"failures", len(summary.Failures),
+	)
+
+	if summary.Matches(r.config.NotifyOn) {
+		for _, notifier := range r.config.Notifiers {
+			if notifyErr := notifier.Notify(summary); notifyErr != nil {
+				slog.Error("notification failed", "error", notifyErr)
+			}
+		}
+	}
+
+	r.release()
+}
+
+// release stops renewing the run lock and releases it.
+func (r *Run) release() {
+	if r.lock == nil {
+		return
+	}
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+	}
+	if err := r.lock.Release(); err != nil {
+		slog.Error("could not release run lock", "lock", r.config.Lock, "error", err)
+	}
+}
+
+// PreflightError reports all problems of the pre-flight check as one error.
+type PreflightError struct {
+	Problems []do.Problem
+}
+
+func (e *PreflightError) Error() string {
+	lines := []string{fmt.Sprintf("pre-flight check failed with %d problems", len(e.Problems))}
+	for _, problem := range e.Problems {
+		lines = append(lines, problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the errors of the API requests which prevented the checks.
+func (e *PreflightError) Unwrap() []error {
+	var errs []error
+	for _, problem := range e.Problems {
+		if problem.Err != nil {
+			errs = append(errs, problem.Err)
+		}
+	}
+	return errs
+}
+
+// auditRecords describes the deleted tags of the plan.
+func auditRecords(runID string, plan *cleanup.Decisions, deleted []cleanup.Tag, dryRun bool) []audit.Record {
+	now := time.Now().UTC()
+
+	records := make([]audit.Record, 0, len(deleted))
+	for _, tag := range deleted {
+		records = append(records, audit.Record{
+			Time:       now,
+			RunID:      runID,
+			Registry:   plan.Registry,
+			Repository: plan.Repository,
+			Tag:        tag.Tag,
+			Digest:     tag.ManifestDigest,
+			SizeBytes:  tag.CompressedSize,
+			Reason:     string(plan.Reasons[tag.Tag]),
+			DryRun:     dryRun,
+		})
+	}
+
+	return records
+}
@@ -0,0 +1,239 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"digitalocean-registry-cleaner/pkg/cleanup"
+	"digitalocean-registry-cleaner/pkg/do"
+	"digitalocean-registry-cleaner/pkg/lock"
+	"digitalocean-registry-cleaner/pkg/notify"
+	"digitalocean-registry-cleaner/pkg/quarantine"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient deletes all planned tags except the failing one.
+type fakeClient struct {
+	problems []do.Problem
+	failing  string
+	executed []*cleanup.Decisions
+	// executing is called before the tags of a plan are deleted
+	executing func()
+}
+
+func (f *fakeClient) Preflight(registry string, repositories []string, write bool) []do.Problem {
+	return f.problems
+}
+
+func (f *fakeClient) ExecutePlan(plan *cleanup.Decisions, dryRun bool) ([]cleanup.Tag, error) {
+	f.executed = append(f.executed, plan)
+	if f.executing != nil {
+		f.executing()
+	}
+
+	var deleted []cleanup.Tag
+	for _, tag := range plan.Delete {
+		if tag.Tag == f.failing {
+			return deleted, errors.New("boom")
+		}
+		deleted = append(deleted, tag)
+	}
+	return deleted, nil
+}
+
+type fakeNotifier struct {
+	summaries []*notify.Summary
+}
+
+func (f *fakeNotifier) Notify(summary *notify.Summary) error {
+	f.summaries = append(f.summaries, summary)
+	return nil
+}
+
+func testPlan(guard cleanup.Guard) *cleanup.Decisions {
+	tags := []cleanup.Tag{
+		{Tag: "latest", ManifestDigest: "sha256:a", CompressedSize: 10},
+		{Tag: "old", ManifestDigest: "sha256:b", CompressedSize: 20},
+		{Tag: "older", ManifestDigest: "sha256:c", CompressedSize: 30},
+	}
+	return &cleanup.Decisions{
+		Registry:   "my-registry",
+		Repository: "backend",
+		Tags:       tags,
+		Delete:     tags[1:],
+		Reasons:    map[string]cleanup.Reason{"old": cleanup.ReasonBranchAge, "older": cleanup.ReasonBranchAge},
+		Guard:      guard,
+	}
+}
+
+func TestStart_Preflight(t *testing.T) {
+	client := &fakeClient{problems: []do.Problem{{Subject: "token", Message: "token is invalid or expired", Hint: "create a new token"}}}
+
+	_, err := Start(client, Config{Registry: "my-registry"}, []string{"backend"})
+	assert.ErrorContains(t, err, "pre-flight check failed with 1 problems")
+	assert.ErrorContains(t, err, "token: token is invalid or expired (create a new token)")
+
+	var preflight *PreflightError
+	assert.ErrorAs(t, err, &preflight)
+	assert.Equal(t, client.problems, preflight.Problems)
+}
+
+func TestStart_Locked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dorc.lock")
+	held, err := lock.Open(path, lock.Config{Holder: "cronjob"})
+	assert.NoError(t, err)
+	assert.NoError(t, held.Acquire())
+
+	_, err = Start(&fakeClient{}, Config{Registry: "my-registry", Lock: path, LockHolder: "api"}, []string{"backend"})
+	assert.ErrorIs(t, err, lock.ErrLocked)
+
+	// dry runs delete nothing and do not take the lock
+	run, err := Start(&fakeClient{}, Config{Registry: "my-registry", Lock: path, LockHolder: "api", DryRun: true}, []string{"backend"})
+	assert.NoError(t, err)
+	run.Finish(nil)
+}
+
+func TestRun_Execute(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{
+		Registry:        "my-registry",
+		Lock:            filepath.Join(dir, "dorc.lock"),
+		LockHolder:      "api",
+		AuditLog:        filepath.Join(dir, "audit.jsonl"),
+		QuarantineState: filepath.Join(dir, "quarantine.json"),
+		Notifiers:       []notify.Notifier{&fakeNotifier{}},
+		NotifyOn:        notify.Deletions,
+	}
+
+	run, err := Start(&fakeClient{failing: "older"}, config, []string{"backend"})
+	assert.NoError(t, err)
+	assert.FileExists(t, config.Lock)
+
+	plan := testPlan(cleanup.Guard{})
+	assert.NoError(t, run.Check([]*cleanup.Decisions{plan}))
+
+	deleted, err := run.Execute(plan)
+	assert.ErrorContains(t, err, "cleanup failed: boom")
+	assert.Len(t, deleted, 1)
+	run.Finish(err)
+
+	assert.NoFileExists(t, config.Lock)
+
+	content, err := os.ReadFile(config.AuditLog)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"tag":"old"`)
+	assert.NotContains(t, string(content), `"tag":"older"`)
+
+	state, err := quarantine.Load(config.QuarantineState)
+	assert.NoError(t, err)
+	assert.Len(t, state.Entries, 1)
+	assert.Equal(t, run.Summary.RunID, state.Entries[0].RunID)
+
+	summaries := config.Notifiers[0].(*fakeNotifier).summaries
+	assert.Len(t, summaries, 1)
+	assert.Equal(t, 1, summaries[0].Deleted)
+	assert.Equal(t, []string{"old"}, summaries[0].Repositories[0].Deleted)
+	assert.Len(t, summaries[0].Failures, 1)
+}
+
+func TestRun_Check(t *testing.T) {
+	client := &fakeClient{}
+	run, err := Start(client, Config{Registry: "my-registry"}, []string{"backend"})
+	assert.NoError(t, err)
+
+	err = run.Check([]*cleanup.Decisions{testPlan(cleanup.Guard{MaxDelete: 1})})
+	assert.ErrorIs(t, err, cleanup.ErrSafetyLimit)
+	assert.Len(t, run.Summary.Failures, 1)
+	assert.Empty(t, client.executed)
+	run.Finish(err)
+}
+
+func TestRun_QuarantineBeforeDeleting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.json")
+	client := &fakeClient{}
+	run, err := Start(client, Config{Registry: "my-registry", QuarantineState: path}, []string{"backend"})
+	assert.NoError(t, err)
+
+	client.executing = func() {
+		state, err := quarantine.Load(path)
+		assert.NoError(t, err)
+		assert.Len(t, state.Entries, 2)
+		assert.True(t, state.Entries[0].Planned)
+	}
+	_, err = run.Execute(testPlan(cleanup.Guard{}))
+	assert.NoError(t, err)
+	run.Finish(nil)
+
+	state, err := quarantine.Load(path)
+	assert.NoError(t, err)
+	assert.Len(t, state.Entries, 2)
+	assert.False(t, state.Entries[0].Planned)
+}
+
+func TestRun_QuarantineSaveFails(t *testing.T) {
+	dir := t.TempDir()
+	notifier := &fakeNotifier{}
+	config := Config{
+		Registry:        "my-registry",
+		AuditLog:        filepath.Join(dir, "audit.jsonl"),
+		QuarantineState: filepath.Join(dir, "quarantine.json"),
+		Notifiers:       []notify.Notifier{notifier},
+		NotifyOn:        notify.Deletions,
+	}
+	client := &fakeClient{}
+	run, err := Start(client, config, []string{"backend"})
+	assert.NoError(t, err)
+
+	// the state cannot be replaced once the tags are deleted
+	client.executing = func() {
+		assert.NoError(t, os.Remove(config.QuarantineState))
+		assert.NoError(t, os.Mkdir(config.QuarantineState, 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(config.QuarantineState, "file"), nil, 0o644))
+	}
+	deleted, err := run.Execute(testPlan(cleanup.Guard{}))
+	assert.ErrorContains(t, err, "could not write quarantine state")
+	assert.Len(t, deleted, 2)
+	run.Finish(err)
+
+	content, err := os.ReadFile(config.AuditLog)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"tag":"older"`)
+
+	assert.Len(t, notifier.summaries, 1)
+	assert.Equal(t, 2, notifier.summaries[0].Deleted)
+	assert.Len(t, notifier.summaries[0].Failures, 1)
+}
+
+func TestRun_RenewsLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dorc.lock")
+	client := &fakeClient{}
+	run, err := Start(client, Config{Registry: "my-registry", Lock: path, LockHolder: "host/1", LockStaleAfter: 30 * time.Millisecond}, []string{"backend"})
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"holder":"host/1/`+run.Summary.RunID+`"`)
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(path)
+		return err == nil && strings.Contains(string(content), "renewed_at")
+	}, time.Second, 5*time.Millisecond)
+
+	// another run took the lock over, e.g. after a network partition
+	assert.NoError(t, os.WriteFile(path, []byte(`{"holder":"other","acquired_at":"2026-10-18T02:00:00Z"}`), 0o644))
+	assert.Eventually(t, func() bool { return run.lost() != nil }, time.Second, 5*time.Millisecond)
+
+	_, err = run.Execute(testPlan(cleanup.Guard{}))
+	assert.ErrorIs(t, err, lock.ErrLocked)
+	assert.Empty(t, client.executed)
+	run.Finish(err)
+
+	content, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"holder":"other"`)
+}
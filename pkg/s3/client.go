@@ -0,0 +1,289 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the object does not exist.
+	ErrNotFound = errors.New("object not found")
+	// ErrPreconditionFailed is returned when the condition of a conditional write does not hold.
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// Condition makes a write conditional on the current object.
+type Condition struct {
+	// IfMatch writes only if the ETag of the object matches.
+	IfMatch string
+	// IfNoneMatch "*" writes only if the object does not exist.
+	IfNoneMatch string
+}
+
+func (c Condition) header() http.Header {
+	header := http.Header{}
+	if c.IfMatch != "" {
+		header.Set("If-Match", c.IfMatch)
+	}
+	if c.IfNoneMatch != "" {
+		header.Set("If-None-Match", c.IfNoneMatch)
+	}
+	return header
+}
+
+// Client is a minimal client for S3-compatible object storage (AWS S3, DigitalOcean Spaces, MinIO)
+// using path-style addressing and AWS Signature Version 4.
+type Client struct {
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// Config configures an S3-compatible storage.
+type Config struct {
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// New creates a client of the storage of the config.
+func New(config Config) (*Client, error) {
+	return NewClient(config.Endpoint, config.Region, config.AccessKey, config.SecretKey)
+}
+
+func NewClient(endpoint, region, accessKey, secretKey string) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint %q: scheme must be http or https", endpoint)
+	}
+
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &Client{
+		endpoint:  u,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    http.DefaultClient,
+		now:       time.Now,
+	}, nil
+}
+
+// PutObject uploads the object, replacing any existing one.
+func (c *Client) PutObject(bucket, key string, body []byte, contentType string) error {
+	return c.PutObjectIf(bucket, key, body, contentType, Condition{})
+}
+
+// PutObjectIf uploads the object if the condition holds, returns ErrPreconditionFailed otherwise.
+func (c *Client) PutObjectIf(bucket, key string, body []byte, contentType string, condition Condition) error {
+	header := condition.header()
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.do(http.MethodPut, bucket, key, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict {
+		return ErrPreconditionFailed
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// GetObject downloads the object, returns ErrNotFound if it does not exist.
+func (c *Client) GetObject(bucket, key string) ([]byte, error) {
+	body, _, err := c.GetObjectETag(bucket, key)
+	return body, err
+}
+
+// GetObjectETag downloads the object and its ETag for conditional writes, returns ErrNotFound if it does not exist.
+func (c *Client) GetObjectETag(bucket, key string) ([]byte, string, error) {
+	resp, err := c.do(http.MethodGet, bucket, key, nil, http.Header{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", responseError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read response body: %w", err)
+	}
+
+	return body, resp.Header.Get("ETag"), nil
+}
+
+// DeleteObject deletes the object, a missing object is not an error.
+func (c *Client) DeleteObject(bucket, key string) error {
+	return c.DeleteObjectIf(bucket, key, Condition{})
+}
+
+// DeleteObjectIf deletes the object if the condition holds, returns ErrPreconditionFailed otherwise.
+// A missing object is not an error.
+func (c *Client) DeleteObjectIf(bucket, key string, condition Condition) error {
+	resp, err := c.do(http.MethodDelete, bucket, key, nil, condition.header())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict {
+		return ErrPreconditionFailed
+	}
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+func (c *Client) do(method, bucket, key string, body []byte, header http.Header) (*http.Response, error) {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket + "/" + strings.TrimPrefix(key, "/")
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("User-Agent", "digitalocean-registry-cleaner")
+
+	c.sign(req, body, c.now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not send request: %w", err)
+	}
+
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 authorization header to the request.
+func (c *Client) sign(req *http.Request, body []byte, now time.Time) {
+	const algorithm = "AWS4-HMAC-SHA256"
+
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// canonical headers - host and every header except the user agent
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "user-agent" || name == "authorization" {
+			continue
+		}
+		headers[name] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, c.accessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := query[key]
+		slices.Sort(values)
+		for _, value := range values {
+			parts = append(parts, url.QueryEscape(key)+"="+strings.ReplaceAll(url.QueryEscape(value), "+", "%20"))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
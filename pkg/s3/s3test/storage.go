@@ -0,0 +1,85 @@
+// Package s3test provides an in-memory S3-compatible server for tests.
+package s3test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Credentials accepted by the storage.
+const (
+	AccessKey = "key"
+	SecretKey = "secret"
+)
+
+// Storage is an in-memory stand-in for an S3-compatible server with conditional writes (If-Match, If-None-Match).
+// Objects are stored by path, /bucket/key.
+type Storage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewServer starts a server of an empty storage, it is closed when the test finishes.
+func NewServer(t testing.TB) (*httptest.Server, *Storage) {
+	storage := &Storage{objects: map[string][]byte{}}
+	server := httptest.NewServer(storage)
+	t.Cleanup(server.Close)
+
+	return server, storage
+}
+
+// Object returns the object at the path, nil if it does not exist.
+func (s *Storage) Object(path string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.objects[path]
+}
+
+// ETag returns the entity tag of the object body.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func (s *Storage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+AccessKey+"/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	current, exists := s.objects[r.URL.Path]
+	if (r.Header.Get("If-None-Match") == "*" && exists) ||
+		(r.Header.Get("If-Match") != "" && (!exists || r.Header.Get("If-Match") != ETag(current))) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		s.objects[r.URL.Path] = body
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<Error><Code>NoSuchKey</Code></Error>"))
+			return
+		}
+		w.Header().Set("ETag", ETag(current))
+		_, _ = w.Write(current)
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
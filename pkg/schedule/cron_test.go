@@ -0,0 +1,68 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNext(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		assert.NoError(t, err)
+		return parsed
+	}
+
+	tests := []struct {
+		spec     string
+		from     string
+		expected string
+	}{
+		{"0 2 * * *", "2026-10-18 01:59", "2026-10-18 02:00"},
+		{"0 2 * * *", "2026-10-18 02:00", "2026-10-19 02:00"},
+		{"*/15 * * * *", "2026-10-18 10:07", "2026-10-18 10:15"},
+		{"30 9 * * mon-fri", "2026-10-17 10:00", "2026-10-19 09:30"}, // Saturday -> Monday
+		{"0 0 1 * *", "2026-12-15 00:00", "2027-01-01 00:00"},
+		{"0 0 * * 7", "2026-10-18 00:00", "2026-10-25 00:00"},    // 7 is Sunday
+		{"0 0 13 * fri", "2026-10-18 00:00", "2026-10-23 00:00"}, // 13th or Friday
+		{"0 12 29 feb *", "2026-10-18 00:00", "2028-02-29 12:00"},
+		{"5,10 1-3/2 * * *", "2026-10-18 01:07", "2026-10-18 01:10"},
+		{"5,10 1-3/2 * * *", "2026-10-18 01:10", "2026-10-18 03:05"},
+		{"@hourly", "2026-10-18 10:07", "2026-10-18 11:00"},
+		{"@daily", "2026-10-18 10:07", "2026-10-19 00:00"},
+		{"@weekly", "2026-10-18 10:07", "2026-10-25 00:00"},
+	}
+
+	for _, test := range tests {
+		s, err := Parse(test.spec)
+		assert.NoError(t, err, test.spec)
+		assert.Equal(t, at(test.expected), s.Next(at(test.from)), test.spec)
+	}
+}
+
+func TestNext_Never(t *testing.T) {
+	s, err := Parse("0 0 30 feb *")
+
+	assert.NoError(t, err)
+	assert.True(t, s.Next(time.Now()).IsZero())
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@reboot",
+	} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}